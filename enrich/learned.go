@@ -0,0 +1,212 @@
+package enrich
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/csmith/musiclover/matcher"
+	"github.com/csmith/musiclover/model"
+	"github.com/csmith/musiclover/state"
+)
+
+const (
+	learnedFile = "learned.json"
+
+	// minLearnConfidence is the lowest confidence a match that isn't based on
+	// track identifiers needs for identifiers to be learned from it, so that
+	// mistakes aren't spread further
+	minLearnConfidence = 0.9
+
+	// learnedDurationBucket is how finely durations are compared when looking
+	// tracks up by name
+	learnedDurationBucket = 10 * time.Second
+)
+
+// Learned remembers identifiers discovered by matching tracks from different
+// services, so that a track known only by name to one service can be given
+// the identifiers another service has for it.
+type Learned struct {
+	mu      sync.Mutex
+	entries map[string]learnedIdentifiers
+	dirty   bool
+}
+
+type learnedIdentifiers struct {
+	// Ambiguous marks names that have been matched to different recordings,
+	// so can't be used to find identifiers
+	Ambiguous  bool     `json:"ambiguous,omitempty"`
+	TrackMBID  string   `json:"track_mbid,omitempty"`
+	ArtistMBID string   `json:"artist_mbid,omitempty"`
+	AlbumMBID  string   `json:"album_mbid,omitempty"`
+	ISRCs      []string `json:"isrcs,omitempty"`
+}
+
+// Load reads previously learned identifiers from the state directory
+func (l *Learned) Load(dir string) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.entries = make(map[string]learnedIdentifiers)
+	return state.Load(dir, learnedFile, &l.entries)
+}
+
+// Save writes the learned identifiers to the state directory, if they've changed
+func (l *Learned) Save(dir string) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if !l.dirty {
+		return nil
+	}
+
+	if err := state.Save(dir, learnedFile, l.entries); err != nil {
+		return err
+	}
+	l.dirty = false
+	return nil
+}
+
+// Record learns the combined identifiers of each matched pair of tracks.
+// Pairs that weren't matched by MBID or ISRC are skipped if they have low
+// confidence.
+func (l *Learned) Record(pairs []matcher.Pair) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.entries == nil {
+		l.entries = make(map[string]learnedIdentifiers)
+	}
+
+	for _, pair := range pairs {
+		if pair.Score < matcher.ISRC && pair.Confidence < minLearnConfidence {
+			continue
+		}
+
+		combined := identifiersOf(pair.Desired).union(identifiersOf(pair.Actual))
+		for _, key := range append(learnedKeys(pair.Desired), learnedKeys(pair.Actual)...) {
+			existing, ok := l.entries[key]
+			entry := combined
+			if isNameKey(key) && ok && (existing.Ambiguous || existing.conflicts(combined.TrackMBID)) {
+				entry = learnedIdentifiers{Ambiguous: true}
+			}
+
+			if !ok || !existing.equal(entry) {
+				l.entries[key] = entry
+				l.dirty = true
+			}
+		}
+	}
+}
+
+// Enrich returns a copy of the tracks with any missing identifiers filled in
+// from those previously learned
+func (l *Learned) Enrich(tracks []model.LovedTrack) []model.LovedTrack {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	enriched := make([]model.LovedTrack, len(tracks))
+	for i, track := range tracks {
+		enriched[i] = track
+		for _, key := range learnedKeys(track) {
+			identifiers, ok := l.entries[key]
+			if !ok || identifiers.Ambiguous {
+				continue
+			}
+
+			// Names only point at a recording, so can't contradict a known one
+			if isNameKey(key) && identifiers.conflicts(enriched[i].TrackMBID) {
+				continue
+			}
+
+			enriched[i] = identifiers.fill(enriched[i])
+		}
+	}
+	return enriched
+}
+
+// learnedKeys returns the keys a track's identifiers are stored under: its
+// MBID, and its names along with its album and rough duration, so that
+// different recordings with the same name are kept apart. Service specific
+// IDs aren't used, as they may clash between services.
+func learnedKeys(track model.LovedTrack) []string {
+	var keys []string
+	if track.TrackMBID != "" {
+		keys = append(keys, "mbid:"+track.TrackMBID)
+	}
+	if track.Artist != "" && track.Track != "" {
+		bucket := track.Duration.Round(learnedDurationBucket) / learnedDurationBucket
+		keys = append(keys, fmt.Sprintf("name:%s|%d", strings.ToLower(track.Artist+"|"+track.Track+"|"+track.Album), bucket))
+	}
+	return keys
+}
+
+// isNameKey determines whether the key is based on a track's names rather
+// than an identifier
+func isNameKey(key string) bool {
+	return strings.HasPrefix(key, "name:")
+}
+
+func identifiersOf(track model.LovedTrack) learnedIdentifiers {
+	return learnedIdentifiers{
+		TrackMBID:  track.TrackMBID,
+		ArtistMBID: track.ArtistMBID,
+		AlbumMBID:  track.AlbumMBID,
+		ISRCs:      track.ISRCs,
+	}
+}
+
+// union combines two sets of identifiers, preferring i's where both have one
+func (i learnedIdentifiers) union(other learnedIdentifiers) learnedIdentifiers {
+	result := i
+	if result.TrackMBID == "" {
+		result.TrackMBID = other.TrackMBID
+	}
+	if result.ArtistMBID == "" {
+		result.ArtistMBID = other.ArtistMBID
+	}
+	if result.AlbumMBID == "" {
+		result.AlbumMBID = other.AlbumMBID
+	}
+
+	result.ISRCs = slices.Clone(i.ISRCs)
+	for _, isrc := range other.ISRCs {
+		if !slices.Contains(result.ISRCs, isrc) {
+			result.ISRCs = append(result.ISRCs, isrc)
+		}
+	}
+	return result
+}
+
+// conflicts determines whether the identifiers are for a different recording
+// than the given MBID
+func (i learnedIdentifiers) conflicts(trackMBID string) bool {
+	return i.TrackMBID != "" && trackMBID != "" && i.TrackMBID != trackMBID
+}
+
+func (i learnedIdentifiers) equal(other learnedIdentifiers) bool {
+	return i.Ambiguous == other.Ambiguous &&
+		i.TrackMBID == other.TrackMBID &&
+		i.ArtistMBID == other.ArtistMBID &&
+		i.AlbumMBID == other.AlbumMBID &&
+		slices.Equal(i.ISRCs, other.ISRCs)
+}
+
+// fill copies identifiers into any empty fields of the track
+func (i learnedIdentifiers) fill(track model.LovedTrack) model.LovedTrack {
+	if track.TrackMBID == "" {
+		track.TrackMBID = i.TrackMBID
+	}
+	if track.ArtistMBID == "" {
+		track.ArtistMBID = i.ArtistMBID
+	}
+	if track.AlbumMBID == "" {
+		track.AlbumMBID = i.AlbumMBID
+	}
+	if len(track.ISRCs) == 0 {
+		track.ISRCs = i.ISRCs
+	}
+	return track
+}
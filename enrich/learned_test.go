@@ -0,0 +1,110 @@
+package enrich
+
+import (
+	"testing"
+	"time"
+
+	"github.com/csmith/musiclover/matcher"
+	"github.com/csmith/musiclover/model"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLearned(t *testing.T) {
+	lastfm := model.LovedTrack{Artist: "Massive Attack", Track: "Teardrop"}
+	subsonic := model.LovedTrack{ID: "123", Artist: "Massive Attack", Track: "Teardrop", TrackMBID: "rec-1", ISRCs: []string{"GBAAA9800012"}}
+
+	l := &Learned{}
+	assert.Equal(t, []model.LovedTrack{lastfm}, l.Enrich([]model.LovedTrack{lastfm}))
+
+	l.Record(matcher.Segment([]model.LovedTrack{lastfm}, []model.LovedTrack{subsonic}).Pairs)
+
+	enriched := l.Enrich([]model.LovedTrack{lastfm, {Artist: "Other", Track: "Song"}})
+	assert.Equal(t, "rec-1", enriched[0].TrackMBID)
+	assert.Equal(t, []string{"GBAAA9800012"}, enriched[0].ISRCs)
+	assert.Equal(t, model.LovedTrack{Artist: "Other", Track: "Song"}, enriched[1])
+	assert.Empty(t, lastfm.TrackMBID, "input should not be modified")
+
+	// Tracks known only by MBID pick up identifiers too
+	enriched = l.Enrich([]model.LovedTrack{{TrackMBID: "rec-1"}})
+	assert.Equal(t, []string{"GBAAA9800012"}, enriched[0].ISRCs)
+}
+
+func TestLearned_SkipsUnconfidentMatches(t *testing.T) {
+	l := &Learned{}
+	l.Record([]matcher.Pair{{
+		Desired:     model.LovedTrack{Artist: "Artist", Track: "Song"},
+		Actual:      model.LovedTrack{Artist: "Artist", Track: "Song (Remix)", TrackMBID: "rec-1"},
+		Explanation: matcher.Explanation{Score: matcher.FuzzyMatch, Confidence: 0.7},
+	}})
+
+	l.Record([]matcher.Pair{{
+		Desired:     model.LovedTrack{Artist: "Artist", Track: "Other Song", ArtistMBID: "artist-1"},
+		Actual:      model.LovedTrack{Artist: "Artist", Track: "Other Song (Live)", ArtistMBID: "artist-1", TrackMBID: "rec-2"},
+		Explanation: matcher.Explanation{Score: matcher.AlbumArtistMBID, Confidence: 0.7},
+	}})
+
+	enriched := l.Enrich([]model.LovedTrack{{Artist: "Artist", Track: "Song"}, {Artist: "Artist", Track: "Other Song"}})
+	assert.Empty(t, enriched[0].TrackMBID)
+	assert.Empty(t, enriched[1].TrackMBID)
+}
+
+func TestLearned_SaveLoad(t *testing.T) {
+	dir := t.TempDir()
+
+	l := &Learned{}
+	l.Record([]matcher.Pair{{
+		Desired:     model.LovedTrack{Artist: "Artist", Track: "Song"},
+		Actual:      model.LovedTrack{Artist: "Artist", Track: "Song", TrackMBID: "rec-1", ArtistMBID: "artist-1"},
+		Explanation: matcher.Explanation{Score: matcher.ExactMatch, Confidence: 0.95},
+	}})
+	require.NoError(t, l.Save(dir))
+
+	loaded := &Learned{}
+	require.NoError(t, loaded.Load(dir))
+	enriched := loaded.Enrich([]model.LovedTrack{{Artist: "artist", Track: "song"}})
+	assert.Equal(t, "rec-1", enriched[0].TrackMBID)
+	assert.Equal(t, "artist-1", enriched[0].ArtistMBID)
+}
+
+func TestLearned_SameNames(t *testing.T) {
+	studio := model.LovedTrack{Artist: "Artist", Track: "Intro", Album: "Studio Album", Duration: 90 * time.Second}
+	live := model.LovedTrack{Artist: "Artist", Track: "Intro", Album: "Live Album", Duration: 240 * time.Second}
+
+	l := &Learned{}
+	l.Record([]matcher.Pair{
+		{
+			Desired:     studio,
+			Actual:      model.LovedTrack{Artist: "Artist", Track: "Intro", TrackMBID: "rec-1", ISRCs: []string{"ISRC1"}},
+			Explanation: matcher.Explanation{Score: matcher.ExactMatch, Confidence: 0.95},
+		},
+		{
+			Desired:     live,
+			Actual:      model.LovedTrack{Artist: "Artist", Track: "Intro", TrackMBID: "rec-2"},
+			Explanation: matcher.Explanation{Score: matcher.ExactMatch, Confidence: 0.95},
+		},
+	})
+
+	enriched := l.Enrich([]model.LovedTrack{studio, live})
+	assert.Equal(t, "rec-1", enriched[0].TrackMBID)
+	assert.Equal(t, "rec-2", enriched[1].TrackMBID)
+
+	// A name doesn't give a track another recording's identifiers
+	enriched = l.Enrich([]model.LovedTrack{{Artist: "Artist", Track: "Intro", Album: "Studio Album", Duration: 90 * time.Second, TrackMBID: "rec-3"}})
+	assert.Empty(t, enriched[0].ISRCs)
+}
+
+func TestLearned_AmbiguousNames(t *testing.T) {
+	untitled := model.LovedTrack{Artist: "Artist", Track: "Untitled"}
+
+	l := &Learned{}
+	for _, mbid := range []string{"rec-1", "rec-2", "rec-1"} {
+		l.Record([]matcher.Pair{{
+			Desired:     untitled,
+			Actual:      model.LovedTrack{Artist: "Artist", Track: "Untitled", TrackMBID: mbid},
+			Explanation: matcher.Explanation{Score: matcher.ExactMatch, Confidence: 0.95},
+		}})
+	}
+
+	assert.Empty(t, l.Enrich([]model.LovedTrack{untitled})[0].TrackMBID)
+}
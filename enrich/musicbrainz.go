@@ -0,0 +1,358 @@
+package enrich
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/csmith/musiclover/matcher"
+	"github.com/csmith/musiclover/model"
+	"github.com/csmith/musiclover/state"
+)
+
+const (
+	musicBrainzCacheFile = "musicbrainz.json"
+	musicBrainzCacheTTL  = 30 * 24 * time.Hour
+	musicBrainzUserAgent = "musiclover/1.0 ( https://github.com/csmith/musiclover )"
+
+	// minSearchScore is the lowest MusicBrainz search score that will be considered
+	minSearchScore = 90
+
+	// musicBrainzSaveInterval is how many new lookups are made before the cache
+	// is saved, so that little is lost if a long run is interrupted
+	musicBrainzSaveInterval = 25
+)
+
+// MusicBrainz fills in missing identifiers and names using the MusicBrainz
+// web service. Recordings are looked up by MBID where one is known, and
+// searched for by artist and title otherwise. Requests are limited to one per
+// second, and responses are cached in StateDir if it is set.
+type MusicBrainz struct {
+	// BaseURL is the address of the MusicBrainz server, e.g. https://musicbrainz.org
+	BaseURL string
+	// StateDir is where lookups are cached between runs. If empty, they're only cached in memory.
+	StateDir string
+
+	mu          sync.Mutex
+	cache       map[string]musicBrainzCacheEntry
+	unsaved     int
+	lastRequest time.Time
+	interval    time.Duration
+}
+
+type musicBrainzCacheEntry struct {
+	Recording *musicBrainzRecording `json:"recording,omitempty"`
+	Fetched   time.Time             `json:"fetched"`
+}
+
+type musicBrainzRecording struct {
+	ID           string                    `json:"id"`
+	Title        string                    `json:"title"`
+	Length       int                       `json:"length"`
+	Score        int                       `json:"score,omitempty"`
+	ISRCs        []string                  `json:"isrcs,omitempty"`
+	ArtistCredit []musicBrainzArtistCredit `json:"artist-credit"`
+	Releases     []musicBrainzRelease      `json:"releases,omitempty"`
+}
+
+type musicBrainzArtistCredit struct {
+	Name       string `json:"name"`
+	JoinPhrase string `json:"joinphrase"`
+	Artist     struct {
+		ID string `json:"id"`
+	} `json:"artist"`
+}
+
+type musicBrainzRelease struct {
+	ID    string `json:"id"`
+	Title string `json:"title"`
+}
+
+type musicBrainzSearchResponse struct {
+	Recordings []musicBrainzRecording `json:"recordings"`
+}
+
+// Enrich returns a copy of the tracks with any missing details filled in
+// from MusicBrainz. Tracks that can't be found, or that fail to be looked up,
+// are returned unchanged. An error is only returned if the cache can't be
+// loaded or saved.
+func (m *MusicBrainz) Enrich(tracks []model.LovedTrack) ([]model.LovedTrack, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if err := m.loadCache(); err != nil {
+		return nil, err
+	}
+
+	enriched := make([]model.LovedTrack, len(tracks))
+	count, failed := 0, 0
+	for i, track := range tracks {
+		enriched[i] = track
+
+		recording, err := m.recordingFor(track)
+		if err != nil {
+			slog.Warn("Failed to enrich track", "artist", track.Artist, "track", track.Track, "mbid", track.TrackMBID, "error", err, "source", "musicbrainz")
+			failed++
+			continue
+		}
+
+		if recording != nil {
+			enriched[i] = fill(track, *recording)
+			count++
+		}
+
+		if m.unsaved >= musicBrainzSaveInterval {
+			if err := m.saveCache(); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	slog.Debug("Enriched tracks from MusicBrainz", "count", count, "failed", failed, "total", len(tracks))
+
+	if err := m.saveCache(); err != nil {
+		return nil, err
+	}
+	return enriched, nil
+}
+
+// saveCache writes the cache to StateDir, if there are new lookups in it
+func (m *MusicBrainz) saveCache() error {
+	if m.unsaved == 0 {
+		return nil
+	}
+
+	if err := state.Save(m.StateDir, musicBrainzCacheFile, m.cache); err != nil {
+		return err
+	}
+	m.unsaved = 0
+	return nil
+}
+
+// loadCache reads the on-disk cache the first time it's needed
+func (m *MusicBrainz) loadCache() error {
+	if m.cache != nil {
+		return nil
+	}
+
+	m.cache = make(map[string]musicBrainzCacheEntry)
+	return state.Load(m.StateDir, musicBrainzCacheFile, &m.cache)
+}
+
+// recordingFor finds the MusicBrainz recording for a track, if it needs
+// enriching and can be found
+func (m *MusicBrainz) recordingFor(track model.LovedTrack) (*musicBrainzRecording, error) {
+	if track.TrackMBID != "" {
+		if track.Track != "" && track.Artist != "" && track.ArtistMBID != "" {
+			return nil, nil
+		}
+
+		return m.cached("mbid:"+track.TrackMBID, func() (*musicBrainzRecording, error) {
+			return m.lookup(track.TrackMBID)
+		})
+	}
+
+	if track.Track == "" || track.Artist == "" {
+		return nil, nil
+	}
+
+	key := "search:" + strings.ToLower(track.Artist+"|"+track.Track)
+	return m.cached(key, func() (*musicBrainzRecording, error) {
+		return m.search(track)
+	})
+}
+
+// cached returns the cached recording for the key, or calls fetch and caches
+// the result. Keys are kept separate for each server.
+func (m *MusicBrainz) cached(key string, fetch func() (*musicBrainzRecording, error)) (*musicBrainzRecording, error) {
+	key = strings.TrimSuffix(m.BaseURL, "/") + "|" + key
+	if entry, ok := m.cache[key]; ok && time.Since(entry.Fetched) < musicBrainzCacheTTL {
+		return entry.Recording, nil
+	}
+
+	recording, err := fetch()
+	if err != nil {
+		return nil, err
+	}
+
+	m.cache[key] = musicBrainzCacheEntry{Recording: recording, Fetched: time.Now()}
+	m.unsaved++
+	return recording, nil
+}
+
+// lookup retrieves a recording by its MBID
+func (m *MusicBrainz) lookup(mbid string) (*musicBrainzRecording, error) {
+	slog.Debug("Looking up recording", "mbid", mbid, "source", "musicbrainz")
+
+	var recording musicBrainzRecording
+	found, err := m.get(fmt.Sprintf("/ws/2/recording/%s?inc=artists+releases+isrcs&fmt=json", url.PathEscape(mbid)), &recording)
+	if err != nil || !found {
+		return nil, err
+	}
+	return &recording, nil
+}
+
+// search finds the recording that best matches the track's names. Only
+// results that MusicBrainz is confident about and that the matcher agrees
+// with are considered.
+func (m *MusicBrainz) search(track model.LovedTrack) (*musicBrainzRecording, error) {
+	slog.Debug("Searching for recording", "artist", track.Artist, "title", track.Track, "source", "musicbrainz")
+
+	query := fmt.Sprintf("recording:%s AND artist:%s", quoteLucene(track.Track), quoteLucene(track.Artist))
+
+	var response musicBrainzSearchResponse
+	if _, err := m.get("/ws/2/recording?limit=10&fmt=json&query="+url.QueryEscape(query), &response); err != nil {
+		return nil, err
+	}
+
+	var recordings []musicBrainzRecording
+	var candidates []model.LovedTrack
+	for _, recording := range response.Recordings {
+		if recording.Score >= minSearchScore {
+			recordings = append(recordings, recording)
+			candidates = append(candidates, recording.toLovedTrack())
+		}
+	}
+
+	index := matcher.Find(candidates, track)
+	if index == -1 {
+		return nil, nil
+	}
+
+	return &recordings[index], nil
+}
+
+// get performs a request against the web service, honouring its rate limit.
+// It returns false if the resource was not found.
+func (m *MusicBrainz) get(path string, v any) (bool, error) {
+	const maxRetries = 3
+
+	for attempt := 0; attempt < maxRetries; attempt++ {
+		m.wait()
+
+		req, err := http.NewRequest(http.MethodGet, strings.TrimSuffix(m.BaseURL, "/")+path, nil)
+		if err != nil {
+			return false, err
+		}
+
+		req.Header.Set("User-Agent", musicBrainzUserAgent)
+		req.Header.Set("Accept", "application/json")
+
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			return false, err
+		}
+		defer resp.Body.Close()
+
+		switch resp.StatusCode {
+		case http.StatusOK:
+			return true, json.NewDecoder(resp.Body).Decode(v)
+		case http.StatusNotFound:
+			return false, nil
+		case http.StatusServiceUnavailable, http.StatusTooManyRequests:
+			slog.Warn("Rate limited, retrying", "attempt", attempt+1, "source", "musicbrainz")
+			time.Sleep(time.Duration(attempt+1) * 5 * time.Second)
+		default:
+			body, _ := io.ReadAll(resp.Body)
+			return false, fmt.Errorf("MusicBrainz API error: %s - %s", resp.Status, string(body))
+		}
+	}
+
+	return false, fmt.Errorf("MusicBrainz: max retries exceeded due to rate limiting")
+}
+
+// wait sleeps until the next request is allowed under the rate limit
+func (m *MusicBrainz) wait() {
+	interval := m.interval
+	if interval == 0 {
+		interval = time.Second
+	}
+
+	if next := m.lastRequest.Add(interval); time.Now().Before(next) {
+		time.Sleep(time.Until(next))
+	}
+	m.lastRequest = time.Now()
+}
+
+// toLovedTrack converts a recording into a LovedTrack
+func (r musicBrainzRecording) toLovedTrack() model.LovedTrack {
+	track := model.LovedTrack{
+		TrackMBID: r.ID,
+		Track:     r.Title,
+		ISRCs:     r.ISRCs,
+		Duration:  time.Duration(r.Length) * time.Millisecond,
+	}
+
+	var artist strings.Builder
+	featured := false
+	for _, credit := range r.ArtistCredit {
+		artist.WriteString(credit.Name + credit.JoinPhrase)
+		track.Artists = append(track.Artists, model.ArtistCredit{
+			Name:     credit.Name,
+			MBID:     credit.Artist.ID,
+			Featured: featured,
+		})
+
+		join := strings.ToLower(credit.JoinPhrase)
+		if strings.Contains(join, "feat") || strings.Contains(join, "ft.") {
+			featured = true
+		}
+	}
+
+	track.Artist = artist.String()
+	if len(track.Artists) > 0 {
+		track.ArtistMBID = track.Artists[0].MBID
+	}
+
+	return track
+}
+
+// fill copies details from the recording into any empty fields of the track.
+// Album details are only added where they can be tied to a specific release.
+func fill(track model.LovedTrack, recording musicBrainzRecording) model.LovedTrack {
+	found := recording.toLovedTrack()
+
+	if track.TrackMBID == "" {
+		track.TrackMBID = found.TrackMBID
+	}
+	if track.Track == "" {
+		track.Track = found.Track
+	}
+	if track.Artist == "" {
+		track.Artist = found.Artist
+	}
+	if track.ArtistMBID == "" {
+		track.ArtistMBID = found.ArtistMBID
+	}
+	if len(track.Artists) == 0 {
+		track.Artists = found.Artists
+	}
+	if len(track.ISRCs) == 0 {
+		track.ISRCs = found.ISRCs
+	}
+	if track.Duration == 0 {
+		track.Duration = found.Duration
+	}
+
+	for _, release := range recording.Releases {
+		if track.AlbumMBID == "" && track.Album != "" && strings.EqualFold(release.Title, track.Album) {
+			track.AlbumMBID = release.ID
+		}
+		if track.Album == "" && track.AlbumMBID != "" && release.ID == track.AlbumMBID {
+			track.Album = release.Title
+		}
+	}
+
+	return track
+}
+
+// quoteLucene quotes a value for use in a MusicBrainz search query
+func quoteLucene(s string) string {
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(s) + `"`
+}
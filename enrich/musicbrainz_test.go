@@ -0,0 +1,191 @@
+package enrich
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/csmith/musiclover/model"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const testRecording = `{
+	"id": "rec-1",
+	"title": "Teardrop",
+	"length": 330000,
+	"isrcs": ["GBAAA9800012"],
+	"artist-credit": [{"name": "Massive Attack", "joinphrase": " feat. ", "artist": {"id": "artist-1"}}, {"name": "Elizabeth Fraser", "joinphrase": "", "artist": {"id": "artist-2"}}],
+	"releases": [{"id": "release-1", "title": "Mezzanine"}, {"id": "release-2", "title": "Collected"}]
+}`
+
+func newTestServer(t *testing.T, requests *int) *httptest.Server {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		*requests++
+		assert.NotEmpty(t, r.Header.Get("User-Agent"))
+
+		switch r.URL.Path {
+		case "/ws/2/recording/rec-1":
+			_, _ = fmt.Fprint(w, testRecording)
+		case "/ws/2/recording/invalid":
+			http.Error(w, `{"error": "Invalid mbid."}`, http.StatusBadRequest)
+		case "/ws/2/recording":
+			_, _ = fmt.Fprintf(w, `{"recordings": [
+				{"id": "rec-2", "score": 100, "title": "Teardrop (live)", "length": 400000, "artist-credit": [{"name": "Massive Attack", "artist": {"id": "artist-1"}}]},
+				{"id": "rec-3", "score": 60, "title": "Teardrop", "artist-credit": [{"name": "Massive Attack", "artist": {"id": "artist-1"}}]},
+				%s
+			]}`, testRecording[:len(testRecording)-1]+`, "score": 98}`)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestMusicBrainz_EnrichByMBID(t *testing.T) {
+	requests := 0
+	m := &MusicBrainz{BaseURL: newTestServer(t, &requests).URL, interval: time.Nanosecond}
+
+	tracks, err := m.Enrich([]model.LovedTrack{
+		{TrackMBID: "rec-1", AlbumMBID: "release-1"},
+	})
+	require.NoError(t, err)
+
+	assert.Equal(t, model.LovedTrack{
+		TrackMBID:  "rec-1",
+		Track:      "Teardrop",
+		Artist:     "Massive Attack feat. Elizabeth Fraser",
+		ArtistMBID: "artist-1",
+		Album:      "Mezzanine",
+		AlbumMBID:  "release-1",
+		ISRCs:      []string{"GBAAA9800012"},
+		Duration:   330 * time.Second,
+		Artists: []model.ArtistCredit{
+			{Name: "Massive Attack", MBID: "artist-1"},
+			{Name: "Elizabeth Fraser", MBID: "artist-2", Featured: true},
+		},
+	}, tracks[0])
+}
+
+func TestMusicBrainz_EnrichBySearch(t *testing.T) {
+	requests := 0
+	m := &MusicBrainz{BaseURL: newTestServer(t, &requests).URL, interval: time.Nanosecond}
+
+	original := model.LovedTrack{Artist: "Massive Attack", Track: "Teardrop", Album: "Mezzanine", Duration: 331 * time.Second}
+	tracks, err := m.Enrich([]model.LovedTrack{original})
+	require.NoError(t, err)
+
+	assert.Equal(t, "rec-1", tracks[0].TrackMBID)
+	assert.Equal(t, "artist-1", tracks[0].ArtistMBID)
+	assert.Equal(t, "release-1", tracks[0].AlbumMBID)
+	assert.Equal(t, "Massive Attack", tracks[0].Artist)
+	assert.Equal(t, 331*time.Second, tracks[0].Duration)
+	assert.Empty(t, original.TrackMBID, "input should not be modified")
+}
+
+func TestMusicBrainz_SkipsCompleteTracks(t *testing.T) {
+	requests := 0
+	m := &MusicBrainz{BaseURL: newTestServer(t, &requests).URL, interval: time.Nanosecond}
+
+	track := model.LovedTrack{TrackMBID: "rec-1", Artist: "Artist", ArtistMBID: "artist-1", Track: "Song"}
+	tracks, err := m.Enrich([]model.LovedTrack{track, {}})
+	require.NoError(t, err)
+
+	assert.Equal(t, []model.LovedTrack{track, {}}, tracks)
+	assert.Equal(t, 0, requests)
+}
+
+func TestMusicBrainz_NotFound(t *testing.T) {
+	requests := 0
+	m := &MusicBrainz{BaseURL: newTestServer(t, &requests).URL, interval: time.Nanosecond}
+
+	track := model.LovedTrack{TrackMBID: "unknown"}
+	tracks, err := m.Enrich([]model.LovedTrack{track})
+	require.NoError(t, err)
+	assert.Equal(t, []model.LovedTrack{track}, tracks)
+}
+
+func TestMusicBrainz_Cache(t *testing.T) {
+	requests := 0
+	server := newTestServer(t, &requests)
+	dir := t.TempDir()
+
+	tracks := []model.LovedTrack{{TrackMBID: "rec-1"}, {TrackMBID: "unknown"}}
+
+	first := &MusicBrainz{BaseURL: server.URL, StateDir: dir, interval: time.Nanosecond}
+	_, err := first.Enrich(tracks)
+	require.NoError(t, err)
+	assert.Equal(t, 2, requests)
+
+	second := &MusicBrainz{BaseURL: server.URL, StateDir: dir, interval: time.Nanosecond}
+	enriched, err := second.Enrich(tracks)
+	require.NoError(t, err)
+	assert.Equal(t, 2, requests, "cached lookups should not be repeated")
+	assert.Equal(t, "Teardrop", enriched[0].Track)
+}
+
+func TestMusicBrainz_SkipsFailures(t *testing.T) {
+	requests := 0
+	server := newTestServer(t, &requests)
+	dir := t.TempDir()
+
+	invalid := model.LovedTrack{TrackMBID: "invalid"}
+	tracks := []model.LovedTrack{invalid, {TrackMBID: "rec-1"}}
+
+	first := &MusicBrainz{BaseURL: server.URL, StateDir: dir, interval: time.Nanosecond}
+	enriched, err := first.Enrich(tracks)
+	require.NoError(t, err)
+	assert.Equal(t, invalid, enriched[0])
+	assert.Equal(t, "Teardrop", enriched[1].Track)
+	assert.Equal(t, 2, requests)
+
+	second := &MusicBrainz{BaseURL: server.URL, StateDir: dir, interval: time.Nanosecond}
+	_, err = second.Enrich(tracks)
+	require.NoError(t, err)
+	assert.Equal(t, 3, requests, "failed lookups should be retried but successful ones cached")
+}
+
+func TestMusicBrainz_SavesCacheDuringLongRuns(t *testing.T) {
+	dir := t.TempDir()
+	savedBeforeEnd := false
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		if requests == musicBrainzSaveInterval+1 {
+			_, err := os.Stat(filepath.Join(dir, musicBrainzCacheFile))
+			savedBeforeEnd = err == nil
+		}
+		http.NotFound(w, r)
+	}))
+	t.Cleanup(server.Close)
+
+	var tracks []model.LovedTrack
+	for i := range musicBrainzSaveInterval + 5 {
+		tracks = append(tracks, model.LovedTrack{TrackMBID: fmt.Sprintf("rec-%d", i)})
+	}
+
+	m := &MusicBrainz{BaseURL: server.URL, StateDir: dir, interval: time.Nanosecond}
+	_, err := m.Enrich(tracks)
+	require.NoError(t, err)
+	assert.True(t, savedBeforeEnd, "cache should be saved before every lookup is done")
+}
+
+func TestMusicBrainz_CacheIsPerServer(t *testing.T) {
+	requests := 0
+	dir := t.TempDir()
+	tracks := []model.LovedTrack{{TrackMBID: "rec-1"}}
+
+	first := &MusicBrainz{BaseURL: newTestServer(t, &requests).URL, StateDir: dir, interval: time.Nanosecond}
+	_, err := first.Enrich(tracks)
+	require.NoError(t, err)
+
+	second := &MusicBrainz{BaseURL: newTestServer(t, &requests).URL, StateDir: dir, interval: time.Nanosecond}
+	_, err = second.Enrich(tracks)
+	require.NoError(t, err)
+	assert.Equal(t, 2, requests, "lookups from another server should not be reused")
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log/slog"
+	"os"
+	"sort"
+
+	"github.com/csmith/envflag/v2"
+	"github.com/csmith/musiclover/matcher"
+	"github.com/csmith/slogflags"
+)
+
+// eval implements the `eval` subcommand, which measures how accurately the
+// matcher pairs up a labelled corpus of tracks.
+func eval(args []string) {
+	fs := flag.NewFlagSet("eval", flag.ExitOnError)
+	corpus := fs.String("corpus", "", "Path to a YAML or JSON corpus of labelled track pairs. If blank, the bundled starter corpus is used.")
+	destination := fs.String("destination", "", "Destination whose match rules should be evaluated. If blank, the default rules are used.")
+
+	// As with explain, global options can come from the environment or the
+	// command line, but the eval-specific ones are only accepted as arguments.
+	envflag.Parse(envflag.WithArguments(nil))
+	flag.CommandLine.VisitAll(func(f *flag.Flag) {
+		fs.Var(f.Value, f.Name, f.Usage)
+	})
+	_ = fs.Parse(args)
+
+	_ = slogflags.Logger(slogflags.WithSetDefault(true))
+	configureMatching()
+
+	var cases []matcher.Case
+	var err error
+	if *corpus == "" {
+		cases, err = matcher.StarterCorpus()
+	} else {
+		cases, err = matcher.LoadCorpus(*corpus)
+	}
+	if err != nil {
+		slog.Error("Failed to load corpus", "error", err)
+		os.Exit(1)
+	}
+
+	report := matcher.Evaluate(cases, matchOptions(*destination)...)
+
+	fmt.Printf("Cases:     %d\n", len(cases))
+	fmt.Printf("Precision: %s (%d of %d matches correct)\n", matcher.FormatConfidence(report.Precision()), report.TruePositives, report.TruePositives+report.FalsePositives)
+	fmt.Printf("Recall:    %s (%d of %d same tracks matched)\n", matcher.FormatConfidence(report.Recall()), report.TruePositives, report.TruePositives+report.FalseNegatives)
+
+	fmt.Println("\nMatches by score:")
+	for _, score := range sortedScores(report.MatchesByScore) {
+		fmt.Printf("  %-16s %d matched, %d false positives\n", score, report.MatchesByScore[score], len(report.FalsePositivesByScore[score]))
+	}
+
+	printOutcomes("False positives", report.FalsePositivesByScore, sortedScores(report.FalsePositivesByScore))
+	printOutcomes("False negatives", report.FalseNegativesByReason, sortedReasons(report.FalseNegativesByReason))
+}
+
+// printOutcomes lists the given outcomes, in groups in the given order
+func printOutcomes[K comparable](title string, outcomes map[K][]matcher.Outcome, groups []K) {
+	total := 0
+	for _, o := range outcomes {
+		total += len(o)
+	}
+
+	fmt.Printf("\n%s: %d\n", title, total)
+	for _, group := range groups {
+		fmt.Printf("\n  %v:\n", group)
+		for _, outcome := range outcomes[group] {
+			fmt.Printf("  - %s\n", outcome.Note)
+			fmt.Printf("      %s\n", describeTrack(outcome.A.LovedTrack()))
+			fmt.Printf("      %s\n", describeTrack(outcome.B.LovedTrack()))
+			fmt.Printf("      %s, %s confident\n", outcome.Rule, matcher.FormatConfidence(outcome.Confidence))
+		}
+	}
+}
+
+// sortedScores returns the keys of a map of scores, best first
+func sortedScores[V any](m map[matcher.Score]V) []matcher.Score {
+	scores := make([]matcher.Score, 0, len(m))
+	for score := range m {
+		scores = append(scores, score)
+	}
+	sort.Slice(scores, func(i, j int) bool {
+		return scores[i] > scores[j]
+	})
+	return scores
+}
+
+// sortedReasons returns the keys of a map of outcomes grouped by reason, most
+// common first
+func sortedReasons(m map[string][]matcher.Outcome) []string {
+	reasons := make([]string, 0, len(m))
+	for reason := range m {
+		reasons = append(reasons, reason)
+	}
+	sort.Slice(reasons, func(i, j int) bool {
+		if len(m[reasons[i]]) != len(m[reasons[j]]) {
+			return len(m[reasons[i]]) > len(m[reasons[j]])
+		}
+		return reasons[i] < reasons[j]
+	})
+	return reasons
+}
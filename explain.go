@@ -0,0 +1,146 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log/slog"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/csmith/envflag/v2"
+	"github.com/csmith/musiclover/matcher"
+	"github.com/csmith/musiclover/model"
+)
+
+// explain implements the `explain` subcommand, which describes how the matcher
+// treats either a single track or every difference in a planned sync.
+func explain(args []string) {
+	fs := flag.NewFlagSet("explain", flag.ExitOnError)
+	artist := fs.String("artist", "", "Artist of the track to explain. If blank, explains the planned sync.")
+	title := fs.String("title", "", "Title of the track to explain. If blank, explains the planned sync.")
+	limit := fs.Int("limit", 3, "Maximum number of candidates to show for each track")
+
+	// Global options can come from the environment or the command line, but the
+	// explain-specific ones are only accepted as arguments.
+	envflag.Parse(envflag.WithArguments(nil))
+	flag.CommandLine.VisitAll(func(f *flag.Flag) {
+		fs.Var(f.Value, f.Name, f.Usage)
+	})
+	_ = fs.Parse(args)
+
+	src, dests := configure()
+
+	sourceTracks, err := lovedTracks(src)
+	if err != nil {
+		slog.Error("Failed to get loved tracks from source", "source", *source, "error", err)
+		os.Exit(1)
+	}
+
+	names := make([]string, 0, len(dests))
+	for name := range dests {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	if *artist != "" || *title != "" {
+		target := explainTarget(model.LovedTrack{Artist: *artist, Track: *title}, sourceTracks)
+		for _, name := range names {
+			destTracks, err := lovedTracks(dests[name])
+			if err != nil {
+				slog.Error("Failed to get loved tracks from destination", "destination", name, "error", err)
+				os.Exit(1)
+			}
+
+			fmt.Printf("\nCandidates in %s:\n", name)
+			printCandidates(destTracks, target, *limit, matchOptions(name))
+		}
+		return
+	}
+
+	for _, name := range names {
+		destTracks, err := lovedTracks(dests[name])
+		if err != nil {
+			slog.Error("Failed to get loved tracks from destination", "destination", name, "error", err)
+			os.Exit(1)
+		}
+
+		segment := matcher.Segment(sourceTracks, destTracks, syncOptions(name)...)
+
+		fmt.Printf("\n=== %s: %d to love ===\n", name, len(segment.Missing))
+		for _, track := range segment.Missing {
+			fmt.Printf("\n%s\n", describeTrack(track))
+			printCandidates(destTracks, track, *limit, matchOptions(name))
+		}
+
+		action := "not in source"
+		if *removeOther {
+			action = "to unlove"
+		}
+		fmt.Printf("\n=== %s: %d %s ===\n", name, len(segment.Extra), action)
+		for _, track := range segment.Extra {
+			fmt.Printf("\n%s\n", describeTrack(track))
+			printCandidates(sourceTracks, track, *limit, matchOptions(name))
+		}
+	}
+}
+
+// explainTarget looks for the requested track in the source, so that its full
+// metadata can be used. If it's not loved there, the names alone are used.
+func explainTarget(target model.LovedTrack, sourceTracks []model.LovedTrack) model.LovedTrack {
+	if index := matcher.Find(sourceTracks, target, matchOptions("")...); index != -1 {
+		fmt.Printf("Found in %s as %s\n", *source, describeTrack(sourceTracks[index]))
+		return sourceTracks[index]
+	}
+
+	fmt.Printf("Not loved in %s, explaining by name only\n", *source)
+	return target
+}
+
+// printCandidates shows the best matches for the target among the given tracks
+func printCandidates(tracks []model.LovedTrack, target model.LovedTrack, limit int, opts []matcher.Option) {
+	candidates := matcher.Rank(tracks, target, opts...)
+	if len(candidates) > limit {
+		candidates = candidates[:limit]
+	}
+
+	if len(candidates) == 0 {
+		fmt.Println("  (no candidates)")
+		return
+	}
+
+	if result := matcher.Search(tracks, target, opts...); len(result.Ambiguous) > 0 {
+		fmt.Printf("  ambiguous: %d candidates match equally well, so none would be chosen\n", len(result.Ambiguous))
+	}
+
+	for i, candidate := range candidates {
+		fmt.Printf("  %d. %s\n", i+1, describeTrack(tracks[candidate.Index]))
+		fmt.Printf("     score: %s, %s confident (%s)\n", candidate.Score, matcher.FormatConfidence(candidate.Confidence), candidate.Rule)
+		if candidate.Distance >= 0 {
+			fmt.Printf("     compared: %q vs %q, distance %d\n", candidate.KeyA, candidate.KeyB, candidate.Distance)
+		}
+		if candidate.DurationDifference >= 0 {
+			fmt.Printf("     durations differ by %s\n", candidate.DurationDifference)
+		}
+	}
+}
+
+// describeTrack formats a track's names and identifiers for display
+func describeTrack(track model.LovedTrack) string {
+	var ids []string
+	if track.ID != "" {
+		ids = append(ids, "id "+track.ID)
+	}
+	if track.TrackMBID != "" {
+		ids = append(ids, "mbid "+track.TrackMBID)
+	}
+
+	description := fmt.Sprintf("%q by %q", track.Track, track.Artist)
+	if track.Album != "" {
+		description += fmt.Sprintf(" on %q", track.Album)
+	}
+	if len(ids) > 0 {
+		description += " [" + strings.Join(ids, ", ") + "]"
+	}
+	return description
+}
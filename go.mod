@@ -9,6 +9,7 @@ require (
 	github.com/stretchr/testify v1.11.1
 	github.com/supersonic-app/go-subsonic v0.0.0-20260125165421-1efaa048a150
 	github.com/twoscott/gobble-fm v1.0.9
+	gopkg.in/yaml.v3 v3.0.1
 )
 
 require (
@@ -16,5 +17,4 @@ require (
 	github.com/google/go-querystring v1.2.0 // indirect
 	github.com/pmezard/go-difflib v1.0.0 // indirect
 	golang.org/x/image v0.13.0 // indirect
-	gopkg.in/yaml.v3 v3.0.1 // indirect
 )
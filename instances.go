@@ -0,0 +1,239 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log/slog"
+	"os"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/csmith/musiclover/model"
+	"github.com/csmith/musiclover/sources"
+)
+
+// instance creates the sources for a service once flags have been parsed,
+// keyed by the names they're known by. If the service isn't configured, it
+// returns none.
+type instance func() map[string]model.Source
+
+// serviceTypes define the options for an instance of each type of service,
+// with the instance's name as a prefix
+var serviceTypes = map[string]func(fs *flag.FlagSet, name string) instance{
+	"subsonic":     subsonicInstance,
+	"lastfm":       lastfmInstance,
+	"listenbrainz": listenbrainzInstance,
+	"musicbrainz":  musicbrainzInstance,
+}
+
+// instanceName matches valid names for instances, which are used as prefixes
+// for their options
+var instanceName = regexp.MustCompile(`^[a-z0-9]+(-[a-z0-9]+)*$`)
+
+var (
+	instancesSpec = flag.String("instances", "", "Comma-separated extra instances of services, as name=type (e.g. 'home-navidrome=subsonic,lastfm-old=lastfm'). Each is configured with its type's options, using its name in place of the type.")
+
+	// instances holds each configured instance, starting with one of each
+	// type named after it
+	instances = []instance{
+		subsonicInstance(flag.CommandLine, "subsonic"),
+		lastfmInstance(flag.CommandLine, "lastfm"),
+		listenbrainzInstance(flag.CommandLine, "listenbrainz"),
+		musicbrainzInstance(flag.CommandLine, "musicbrainz"),
+	}
+)
+
+// defineInstances adds the options for each extra instance given in the
+// instances option. As this has to be done before flags are parsed, the
+// option is found by looking through the arguments, then the environment.
+func defineInstances(args []string) error {
+	spec := os.Getenv("INSTANCES")
+	for i := 0; i < len(args); i++ {
+		if args[i] == "--" {
+			break
+		}
+
+		name, value, hasValue := strings.Cut(strings.TrimLeft(args[i], "-"), "=")
+		if !strings.HasPrefix(args[i], "-") || name != "instances" {
+			continue
+		}
+
+		if !hasValue && i+1 < len(args) {
+			value = args[i+1]
+		}
+		spec = value
+	}
+
+	for _, entry := range commaSeparated(spec) {
+		name, serviceType, found := strings.Cut(entry, "=")
+		name, serviceType = strings.TrimSpace(name), strings.TrimSpace(serviceType)
+		if !found {
+			return fmt.Errorf("instance %q must be given as name=type", entry)
+		}
+
+		if !instanceName.MatchString(name) {
+			return fmt.Errorf("instance name %q must only contain lowercase letters, numbers and dashes", name)
+		}
+
+		define, ok := serviceTypes[serviceType]
+		if !ok {
+			return fmt.Errorf("unknown type %q for instance %s, expected subsonic, lastfm, listenbrainz or musicbrainz", serviceType, name)
+		}
+
+		// Options are defined separately first, so that conflicts with existing
+		// ones can be reported rather than panicking
+		fs := flag.NewFlagSet(name, flag.ContinueOnError)
+		inst := define(fs, name)
+
+		var err error
+		fs.VisitAll(func(f *flag.Flag) {
+			if flag.CommandLine.Lookup(f.Name) != nil {
+				err = fmt.Errorf("instance %s has an option %s that's already defined", name, f.Name)
+			}
+		})
+		if err != nil {
+			return err
+		}
+
+		fs.VisitAll(func(f *flag.Flag) {
+			flag.CommandLine.Var(f.Value, f.Name, f.Usage)
+		})
+		instances = append(instances, inst)
+	}
+
+	return nil
+}
+
+// initialiseSources creates the sources for each configured instance
+func initialiseSources() {
+	availableSources = make(map[string]model.Source)
+
+	for _, inst := range instances {
+		for name, src := range inst() {
+			if _, ok := availableSources[name]; ok {
+				slog.Error("Several sources have the same name", "name", name)
+				os.Exit(1)
+			}
+			availableSources[name] = src
+		}
+	}
+}
+
+// subsonicInstance defines the options for a Subsonic server. If a playlist
+// is configured, it's available as a separate source with "-playlist" added
+// to the name.
+func subsonicInstance(fs *flag.FlagSet, name string) instance {
+	server := fs.String(name+"-server", "", "Subsonic server base address")
+	username := fs.String(name+"-username", "", "Subsonic username")
+	password := fs.String(name+"-password", "", "Subsonic password")
+	apiKey := fs.String(name+"-api-key", "", "OpenSubsonic API key, used instead of a username and password")
+	folders := fs.String(name+"-music-folders", "", "Comma-separated names or IDs of the Subsonic music folders to use. If blank, all folders are used.")
+	playlist := fs.String(name+"-playlist", "", fmt.Sprintf("Name of a Subsonic playlist to make available as the '%s-playlist' source or destination", name))
+	copies := fs.Bool(name+"-star-all-copies", false, "Star every copy of a track in the Subsonic library, rather than just the preferred one")
+	rebuild := fs.Duration(name+"-rebuild-interval", 7*24*time.Hour, "How often to rebuild the cached index of the Subsonic library from scratch. If zero, it's only updated with new albums.")
+
+	return func() map[string]model.Source {
+		if *server == "" {
+			return nil
+		}
+
+		newSubsonic := func(sourceName string) *sources.Subsonic {
+			return &sources.Subsonic{
+				BaseURL:         *server,
+				Username:        *username,
+				Password:        *password,
+				APIKey:          *apiKey,
+				ClientName:      "musiclover",
+				MatchOptions:    matchOptions(sourceName),
+				Pairings:        pairings,
+				StarAllCopies:   *copies,
+				MusicFolders:    commaSeparated(*folders),
+				StateDir:        *stateDir,
+				RebuildInterval: *rebuild,
+			}
+		}
+
+		result := map[string]model.Source{name: newSubsonic(name)}
+		if *playlist != "" {
+			src := newSubsonic(name + "-playlist")
+			src.Playlist = *playlist
+			result[name+"-playlist"] = src
+		}
+		return result
+	}
+}
+
+// lastfmInstance defines the options for a Last.fm account
+func lastfmInstance(fs *flag.FlagSet, name string) instance {
+	key := fs.String(name+"-key", "", "Last.fm API key")
+	secret := fs.String(name+"-secret", "", "Last.fm API secret")
+	username := fs.String(name+"-username", "", "Last.fm username")
+	password := fs.String(name+"-password", "", "Last.fm password")
+	details := fs.Bool(name+"-fetch-details", false, "Look up each Last.fm loved track to find its duration and album (one extra request per track)")
+
+	return func() map[string]model.Source {
+		if *key == "" || *secret == "" {
+			return nil
+		}
+
+		return map[string]model.Source{name: &sources.Lastfm{
+			APIKey:       *key,
+			Secret:       *secret,
+			Username:     *username,
+			Password:     *password,
+			FetchDetails: *details,
+		}}
+	}
+}
+
+// listenbrainzInstance defines the options for a ListenBrainz account
+func listenbrainzInstance(fs *flag.FlagSet, name string) instance {
+	token := fs.String(name+"-token", "", "ListenBrainz token")
+	username := fs.String(name+"-username", "", "ListenBrainz username")
+	details := fs.Bool(name+"-fetch-details", false, "Look up ListenBrainz loved recordings to find their durations (one extra request per 50 tracks)")
+	hatedRating := fs.Int(name+"-hated-rating", 1, "Rating (1-5) that hated ListenBrainz tracks are synced as. If zero, hates aren't synced as ratings.")
+
+	return func() map[string]model.Source {
+		if *token == "" {
+			return nil
+		}
+
+		if *hatedRating < 0 || *hatedRating > 5 {
+			slog.Error("Hated rating must be between 0 and 5", "option", name+"-hated-rating", "value", *hatedRating)
+			os.Exit(1)
+		}
+
+		return map[string]model.Source{name: &sources.ListenBrainz{
+			Token:        *token,
+			Username:     *username,
+			FetchDetails: *details,
+			HatedRating:  *hatedRating,
+		}}
+	}
+}
+
+// musicbrainzInstance defines the options for a MusicBrainz account, whose
+// collections hold loved tracks, albums and artists
+func musicbrainzInstance(fs *flag.FlagSet, name string) instance {
+	username := fs.String(name+"-username", "", "MusicBrainz username, needed to change collections or read private ones")
+	password := fs.String(name+"-password", "", "MusicBrainz password")
+	recordings := fs.String(name+"-recording-collection", "", "MBID of a MusicBrainz collection of recordings to keep loved tracks in")
+	releases := fs.String(name+"-release-collection", "", "MBID of a MusicBrainz collection of releases to keep loved albums in")
+	artists := fs.String(name+"-artist-collection", "", "MBID of a MusicBrainz collection of artists to keep loved artists in")
+
+	return func() map[string]model.Source {
+		if *recordings == "" && *releases == "" && *artists == "" {
+			return nil
+		}
+
+		return map[string]model.Source{name: &sources.MusicBrainz{
+			BaseURL:             *musicbrainzURL,
+			Username:            *username,
+			Password:            *password,
+			RecordingCollection: *recordings,
+			ReleaseCollection:   *releases,
+			ArtistCollection:    *artists,
+		}}
+	}
+}
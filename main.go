@@ -5,42 +5,89 @@ import (
 	"fmt"
 	"log/slog"
 	"os"
+	"slices"
 	"strings"
 	"time"
 
 	"github.com/csmith/envflag/v2"
+	"github.com/csmith/musiclover/enrich"
 	"github.com/csmith/musiclover/matcher"
 	"github.com/csmith/musiclover/model"
-	"github.com/csmith/musiclover/sources"
 	"github.com/csmith/slogflags"
 )
 
 var (
-	subsonicServer   = flag.String("subsonic-server", "", "Subsonic server base address")
-	subsonicUsername = flag.String("subsonic-username", "", "Subsonic username")
-	subsonicPassword = flag.String("subsonic-password", "", "Subsonic password")
-
-	lastfmKey      = flag.String("lastfm-key", "", "Last.fm API key")
-	lastfmSecret   = flag.String("lastfm-secret", "", "Last.fm API secret")
-	lastfmUsername = flag.String("lastfm-username", "", "Last.fm username")
-	lastfmPassword = flag.String("lastfm-password", "", "Last.fm password")
-
-	listenbrainzToken    = flag.String("listenbrainz-token", "", "ListenBrainz token")
-	listenbrainzUsername = flag.String("listenbrainz-username", "", "ListenBrainz username")
-
-	source       = flag.String("source", "", "Source of truth for loved tracks")
-	destinations = flag.String("destinations", "", "Comma-separated list of destinations to sync loved tracks to")
-	dryRun       = flag.Bool("dry-run", false, "Don't actually do anything, just print the differences in loves")
-	removeOther  = flag.Bool("remove-other", false, "Remove tracks that were loved but aren't in the source")
-	period       = flag.Duration("period", 0, "Length of time between each update. If zero, will update once and exit.")
+	source        = flag.String("source", "", "Source of truth for loved tracks")
+	destinations  = flag.String("destinations", "", "Comma-separated list of destinations to sync loved tracks to")
+	kinds         = flag.String("kinds", "tracks", "Comma-separated kinds of loves to sync: tracks, albums, artists and/or ratings")
+	loveRating    = flag.Int("love-rating", 0, "Minimum rating (1-5) for a track in the source to count as loved. If zero, ratings don't affect loves.")
+	lovedRating   = flag.Int("loved-rating", 0, "Rating (1-5) to give loved tracks in destinations with ratings, if they aren't already rated. If zero, loved tracks aren't rated.")
+	dryRun        = flag.Bool("dry-run", false, "Don't actually do anything, just print the differences in loves")
+	removeOther   = flag.Bool("remove-other", false, "Remove tracks that were loved but aren't in the source")
+	period        = flag.Duration("period", 0, "Length of time between each update. If zero, will update once and exit.")
+	overridesPath = flag.String("overrides", "", "Path to a YAML or JSON file of manual match overrides, reloaded on each update")
+	minConfidence = flag.Float64("min-confidence", 0, "Minimum confidence (0-1) required to match tracks by name rather than MBID or ISRC")
+	aliasesPath   = flag.String("aliases", "", "Path to a YAML or JSON file mapping artist names to their other names")
+	matchRules    = flag.String("match-rules", "", "Rules used to match tracks, e.g. 'overrides,mbid,isrc,exact'. Prefix with 'destination=' to configure a single destination, separating entries with ';'")
+	tieBreakers   = flag.String("tie-breakers", "original-album,non-live,has-mbid,bitrate", "Comma-separated preferences used to choose between equally good matches, in order of priority")
+	duplicates    = flag.String("duplicate-score", "ISRC", "Minimum match score (e.g. ISRC, TrackMBID) for tracks to be treated as copies of the same recording. If blank, tracks are never treated as copies.")
+	stateDir      = flag.String("state-dir", "", "Directory to keep caches and other state in between runs. If blank, nothing is persisted.")
+
+	musicbrainzEnrich  = flag.Bool("musicbrainz-enrich", false, "Look up missing names and identifiers on MusicBrainz before matching")
+	musicbrainzAliases = flag.String("musicbrainz-aliases", "", "Path to a MusicBrainz JSON artist dump to read artist aliases from")
+	musicbrainzURL     = flag.String("musicbrainz-url", "https://musicbrainz.org", "Base address of the MusicBrainz server to use for enrichment and collections")
 
 	availableSources map[string]model.Source
+	syncKinds        map[string]bool
+	overrides        = &matcher.Overrides{}
+	pairings         = &matcher.Pairings{}
+	artistAliases    = &matcher.Aliases{}
+	tieBreakerOrder  []matcher.TieBreaker
+	duplicateScore   matcher.Score
+	rulePipelines    map[string]matcher.Pipeline
+	enricher         *enrich.MusicBrainz
+	learned          = &enrich.Learned{}
 )
 
 func main() {
+	if err := defineInstances(os.Args[1:]); err != nil {
+		slog.Error("Invalid instances", "error", err)
+		os.Exit(1)
+	}
+
+	if len(os.Args) > 1 && os.Args[1] == "explain" {
+		explain(os.Args[2:])
+		return
+	}
+
+	if len(os.Args) > 1 && os.Args[1] == "eval" {
+		eval(os.Args[2:])
+		return
+	}
+
 	envflag.Parse()
+	src, dests := configure()
+
+	if period.Minutes() < 1 {
+		slog.Debug("Period is less than 1 minute, doing a one-shot run")
+		run(src, dests)
+	} else {
+		for {
+			run(src, dests)
+			slog.Info("Sleeping until next update", "period", period)
+			time.Sleep(*period)
+		}
+	}
+}
+
+// configure sets up logging, sources and matching once flags have been parsed,
+// and returns the selected source and destinations.
+func configure() (model.Source, map[string]model.Source) {
 	_ = slogflags.Logger(slogflags.WithSetDefault(true))
 
+	// Done before sources are initialised, as some of them take match options
+	configureMatching()
+
 	initialiseSources()
 
 	src, err := selectedSource()
@@ -55,60 +102,348 @@ func main() {
 		os.Exit(1)
 	}
 
-	if period.Minutes() < 1 {
-		slog.Debug("Period is less than 1 minute, doing a one-shot run")
-		run(src, dests)
-	} else {
-		for {
-			run(src, dests)
-			slog.Info("Sleeping until next update", "period", period)
-			time.Sleep(*period)
+	if err := configureKinds(src, dests); err != nil {
+		slog.Error("Invalid kinds of loves to sync", "error", err)
+		os.Exit(1)
+	}
+
+	if err := pairings.Load(*stateDir); err != nil {
+		slog.Error("Failed to load remembered pairings", "error", err)
+		os.Exit(1)
+	}
+
+	if err := learned.Load(*stateDir); err != nil {
+		slog.Error("Failed to load learned identifiers", "error", err)
+		os.Exit(1)
+	}
+
+	if *musicbrainzEnrich {
+		enricher = &enrich.MusicBrainz{
+			BaseURL:  *musicbrainzURL,
+			StateDir: *stateDir,
 		}
 	}
+
+	return src, dests
 }
 
-func run(src model.Source, dests map[string]model.Source) {
-	sourceTracks, err := src.LovedTracks()
+// configureMatching validates the matching options, and loads any overrides
+// and aliases
+func configureMatching() {
+	var err error
+	tieBreakerOrder, err = matcher.ParseTieBreakers(*tieBreakers)
 	if err != nil {
-		slog.Error("Failed to get loved tracks from source", "source", *source, "error", err)
+		slog.Error("Invalid tie-breakers", "error", err)
 		os.Exit(1)
 	}
 
-	for name, dest := range dests {
-		if err := sync(name, dest, sourceTracks); err != nil {
-			slog.Error("Failed to sync to destination", "destination", name, "error", err)
+	if *duplicates != "" {
+		duplicateScore, err = matcher.ParseScore(*duplicates)
+		if err != nil {
+			slog.Error("Invalid duplicate score", "error", err)
 			os.Exit(1)
 		}
 	}
+
+	rulePipelines, err = parseMatchRules(*matchRules)
+	if err != nil {
+		slog.Error("Invalid match rules", "error", err)
+		os.Exit(1)
+	}
+
+	if *minConfidence < 0 || *minConfidence > 1 {
+		slog.Error("Minimum confidence must be between 0 and 1", "min_confidence", *minConfidence)
+		os.Exit(1)
+	}
+
+	if *overridesPath != "" {
+		if err := overrides.Load(*overridesPath); err != nil {
+			slog.Error("Failed to load overrides", "path", *overridesPath, "error", err)
+			os.Exit(1)
+		}
+	}
+
+	if *aliasesPath != "" {
+		if err := artistAliases.Load(*aliasesPath); err != nil {
+			slog.Error("Failed to load aliases", "path", *aliasesPath, "error", err)
+			os.Exit(1)
+		}
+	}
+
+	if *musicbrainzAliases != "" {
+		if err := artistAliases.LoadMusicBrainzDump(*musicbrainzAliases); err != nil {
+			slog.Error("Failed to load MusicBrainz aliases", "path", *musicbrainzAliases, "error", err)
+			os.Exit(1)
+		}
+	}
+}
+
+// configureKinds checks which kinds of loves are to be synced, and that the
+// source supports them. Destinations that don't support albums, artists or
+// ratings only have their tracks synced.
+func configureKinds(src model.Source, dests map[string]model.Source) error {
+	syncKinds = make(map[string]bool)
+	for _, kind := range commaSeparated(*kinds) {
+		kind = strings.ToLower(kind)
+		if kind != "tracks" && kind != "albums" && kind != "artists" && kind != "ratings" {
+			return fmt.Errorf("unknown kind %q, expected tracks, albums, artists or ratings", kind)
+		}
+		syncKinds[kind] = true
+	}
+
+	if len(syncKinds) == 0 {
+		return fmt.Errorf("at least one kind must be specified")
+	}
+
+	if *loveRating < 0 || *loveRating > 5 || *lovedRating < 0 || *lovedRating > 5 {
+		return fmt.Errorf("ratings must be between 1 and 5, or zero to disable")
+	}
+
+	if syncKinds["tracks"] && !model.Syncs(src, "tracks") {
+		return fmt.Errorf("source %s doesn't support loving tracks", *source)
+	}
+
+	if _, ok := albumSource(src); syncKinds["albums"] && !ok {
+		return fmt.Errorf("source %s doesn't support loving albums", *source)
+	}
+
+	if _, ok := artistSource(src); syncKinds["artists"] && !ok {
+		return fmt.Errorf("source %s doesn't support loving artists", *source)
+	}
+
+	if _, ok := src.(model.RatingSource); (syncKinds["ratings"] || *loveRating > 0) && !ok {
+		return fmt.Errorf("source %s doesn't support ratings", *source)
+	}
+
+	for name, dest := range dests {
+		if syncKinds["tracks"] && !model.Syncs(dest, "tracks") {
+			slog.Warn("Destination doesn't support loving tracks, they won't be synced", "destination", name)
+		}
+		if _, ok := albumSource(dest); syncKinds["albums"] && !ok {
+			slog.Warn("Destination doesn't support loving albums, they won't be synced", "destination", name)
+		}
+		if _, ok := artistSource(dest); syncKinds["artists"] && !ok {
+			slog.Warn("Destination doesn't support loving artists, they won't be synced", "destination", name)
+		}
+		if _, ok := dest.(model.RatingSource); syncKinds["ratings"] && !ok {
+			slog.Warn("Destination doesn't support ratings, they won't be synced", "destination", name)
+		}
+	}
+
+	return nil
+}
+
+// albumSource returns the source as an AlbumSource, if it can love albums
+func albumSource(src model.Source) (model.AlbumSource, bool) {
+	albums, ok := src.(model.AlbumSource)
+	return albums, ok && model.Syncs(src, "albums")
+}
+
+// artistSource returns the source as an ArtistSource, if it can love artists
+func artistSource(src model.Source) (model.ArtistSource, bool) {
+	artists, ok := src.(model.ArtistSource)
+	return artists, ok && model.Syncs(src, "artists")
+}
+
+// parseMatchRules parses the match-rules option into a pipeline for each
+// destination. Rules without a destination are stored under the empty name.
+func parseMatchRules(spec string) (map[string]matcher.Pipeline, error) {
+	pipelines := make(map[string]matcher.Pipeline)
+	for _, entry := range strings.Split(spec, ";") {
+		if strings.TrimSpace(entry) == "" {
+			continue
+		}
+
+		name, rules, found := strings.Cut(entry, "=")
+		if !found {
+			name, rules = "", entry
+		}
+
+		pipeline, err := matcher.ParseRules(rules, overrides)
+		if err != nil {
+			return nil, fmt.Errorf("rules for %q: %w", strings.TrimSpace(name), err)
+		}
+		pipelines[strings.TrimSpace(name)] = pipeline
+	}
+	return pipelines, nil
+}
+
+// matchOptions returns the options to use whenever tracks are matched against
+// the named destination's tracks. The name may be blank for general matching.
+func matchOptions(destination string) []matcher.Option {
+	opts := []matcher.Option{
+		matcher.WithOverrides(overrides),
+		matcher.WithMinConfidence(*minConfidence),
+		matcher.WithTieBreakers(tieBreakerOrder...),
+		matcher.WithAliases(artistAliases),
+		matcher.WithDuplicates(duplicateScore),
+	}
+
+	if pipeline, ok := rulePipelines[destination]; ok {
+		opts = append(opts, matcher.WithMatcher(pipeline))
+	} else if pipeline, ok := rulePipelines[""]; ok {
+		opts = append(opts, matcher.WithMatcher(pipeline))
+	}
+
+	return opts
+}
+
+// syncOptions returns the options to use when comparing the source's loved
+// tracks with those of the named destination
+func syncOptions(destination string) []matcher.Option {
+	return append(matchOptions(destination), matcher.WithPairings(pairings, pairingNamespace(destination)))
+}
+
+// pairingNamespace identifies the source and named destination in remembered
+// pairings
+func pairingNamespace(destination string) string {
+	return *source + ">" + destination
+}
+
+// lovedTracks retrieves the loved tracks from a source, adding any identifiers
+// learned from previous matches and enriching them with extra metadata if
+// configured to
+func lovedTracks(src model.Source) ([]model.LovedTrack, error) {
+	tracks, err := src.LovedTracks()
+	if err != nil {
+		return nil, err
+	}
+	return enrichTracks(tracks), nil
+}
+
+// ratedTracks retrieves the rated tracks from a source, adding identifiers
+// and metadata in the same way as lovedTracks
+func ratedTracks(src model.RatingSource) ([]model.LovedTrack, error) {
+	tracks, err := src.RatedTracks()
+	if err != nil {
+		return nil, err
+	}
+	return enrichTracks(tracks), nil
+}
+
+// enrichTracks adds any identifiers learned from previous matches to tracks,
+// and enriches them with extra metadata if configured to. If enriching fails,
+// the tracks are used without the extra metadata.
+func enrichTracks(tracks []model.LovedTrack) []model.LovedTrack {
+	tracks = learned.Enrich(tracks)
+	if enricher == nil {
+		return tracks
+	}
+
+	enriched, err := enricher.Enrich(tracks)
+	if err != nil {
+		slog.Warn("Failed to enrich tracks", "error", err)
+		return tracks
+	}
+	return enriched
+}
+
+// withRatedLoves adds the rated tracks that count as loved according to the
+// love-rating option to the loved tracks, if they're not already there
+func withRatedLoves(loved, rated []model.LovedTrack) []model.LovedTrack {
+	seen := make(map[string]bool)
+	for _, track := range loved {
+		seen[track.Identity()] = true
+	}
+
+	for _, track := range rated {
+		if track.Rating >= *loveRating && !seen[track.Identity()] {
+			seen[track.Identity()] = true
+			loved = append(loved, track)
+		}
+	}
+	return loved
 }
 
-func initialiseSources() {
-	availableSources = make(map[string]model.Source)
+func run(src model.Source, dests map[string]model.Source) {
+	if *overridesPath != "" {
+		if err := overrides.Load(*overridesPath); err != nil {
+			slog.Error("Failed to reload overrides, using previous version", "path", *overridesPath, "error", err)
+		}
+	}
 
-	if *subsonicServer != "" {
-		availableSources["subsonic"] = &sources.Subsonic{
-			BaseURL:    *subsonicServer,
-			Username:   *subsonicUsername,
-			Password:   *subsonicPassword,
-			ClientName: "musiclover",
+	var sourceTracks, sourceRated []model.LovedTrack
+	var sourceAlbums []model.LovedAlbum
+	var sourceArtists []model.LovedArtist
+	var err error
+
+	if syncKinds["ratings"] || *loveRating > 0 {
+		sourceRated, err = ratedTracks(src.(model.RatingSource))
+		if err != nil {
+			slog.Error("Failed to get rated tracks from source", "source", *source, "error", err)
+			os.Exit(1)
 		}
 	}
 
-	if *lastfmKey != "" && *lastfmSecret != "" {
-		availableSources["lastfm"] = &sources.Lastfm{
-			APIKey:   *lastfmKey,
-			Secret:   *lastfmSecret,
-			Username: *lastfmUsername,
-			Password: *lastfmPassword,
+	if syncKinds["tracks"] {
+		sourceTracks, err = lovedTracks(src)
+		if err != nil {
+			slog.Error("Failed to get loved tracks from source", "source", *source, "error", err)
+			os.Exit(1)
+		}
+
+		if *loveRating > 0 {
+			sourceTracks = withRatedLoves(sourceTracks, sourceRated)
 		}
 	}
 
-	if *listenbrainzToken != "" {
-		availableSources["listenbrainz"] = &sources.ListenBrainz{
-			Token:    *listenbrainzToken,
-			Username: *listenbrainzUsername,
+	if syncKinds["albums"] {
+		sourceAlbums, err = src.(model.AlbumSource).LovedAlbums()
+		if err != nil {
+			slog.Error("Failed to get loved albums from source", "source", *source, "error", err)
+			os.Exit(1)
 		}
 	}
+
+	if syncKinds["artists"] {
+		sourceArtists, err = src.(model.ArtistSource).LovedArtists()
+		if err != nil {
+			slog.Error("Failed to get loved artists from source", "source", *source, "error", err)
+			os.Exit(1)
+		}
+	}
+
+	for name, dest := range dests {
+		if syncKinds["tracks"] {
+			if err := sync(name, dest, sourceTracks); err != nil {
+				slog.Error("Failed to sync to destination", "destination", name, "error", err)
+				os.Exit(1)
+			}
+		}
+
+		if syncKinds["ratings"] || (syncKinds["tracks"] && *lovedRating > 0) {
+			if err := syncRatings(name, src, dest, sourceRated, sourceTracks); err != nil {
+				slog.Error("Failed to sync ratings to destination", "destination", name, "error", err)
+				os.Exit(1)
+			}
+		}
+
+		if syncKinds["albums"] {
+			if err := syncAlbums(name, dest, sourceAlbums); err != nil {
+				slog.Error("Failed to sync albums to destination", "destination", name, "error", err)
+				os.Exit(1)
+			}
+		}
+
+		if syncKinds["artists"] {
+			if err := syncArtists(name, dest, sourceArtists); err != nil {
+				slog.Error("Failed to sync artists to destination", "destination", name, "error", err)
+				os.Exit(1)
+			}
+		}
+	}
+
+	if *dryRun {
+		return
+	}
+
+	if err := pairings.Save(*stateDir); err != nil {
+		slog.Error("Failed to save remembered pairings", "error", err)
+	}
+
+	if err := learned.Save(*stateDir); err != nil {
+		slog.Error("Failed to save learned identifiers", "error", err)
+	}
 }
 
 func selectedSource() (model.Source, error) {
@@ -124,6 +459,17 @@ func selectedSource() (model.Source, error) {
 	return src, nil
 }
 
+// commaSeparated splits a comma-separated option into its non-empty entries
+func commaSeparated(value string) []string {
+	var entries []string
+	for _, entry := range strings.Split(value, ",") {
+		if entry = strings.TrimSpace(entry); entry != "" {
+			entries = append(entries, entry)
+		}
+	}
+	return entries
+}
+
 func selectedDestinations() (map[string]model.Source, error) {
 	if *destinations == "" {
 		return nil, fmt.Errorf("destinations must be specified")
@@ -154,12 +500,19 @@ func selectedDestinations() (map[string]model.Source, error) {
 }
 
 func sync(name string, dest model.Source, sourceTracks []model.LovedTrack) error {
-	destTracks, err := dest.LovedTracks()
+	if !model.Syncs(dest, "tracks") {
+		return nil
+	}
+
+	destTracks, err := lovedTracks(dest)
 	if err != nil {
 		return fmt.Errorf("failed to get loved tracks: %w", err)
 	}
 
-	segment := matcher.Segment(sourceTracks, destTracks)
+	// Earlier destinations may have taught us identifiers for the source tracks
+	sourceTracks = learned.Enrich(sourceTracks)
+
+	segment := matcher.Segment(sourceTracks, destTracks, syncOptions(name)...)
 
 	toLove := segment.Missing
 	var toUnlove []model.LovedTrack
@@ -175,9 +528,24 @@ func sync(name string, dest model.Source, sourceTracks []model.LovedTrack) error
 		"to_remove", len(toUnlove),
 		"source", *source,
 		"source_count", len(sourceTracks),
+		"ignored", len(segment.Ignored),
+		"duplicates", len(segment.Duplicates),
 	)
 
 	if *dryRun {
+		for _, pair := range segment.Pairs {
+			if pair.Score < matcher.ISRC {
+				slog.Info(
+					"Matched by name",
+					"artist", pair.Desired.Artist,
+					"title", pair.Desired.Track,
+					"matched_artist", pair.Actual.Artist,
+					"matched_title", pair.Actual.Track,
+					"confidence", matcher.FormatConfidence(pair.Confidence),
+					"destination", name,
+				)
+			}
+		}
 		for _, track := range toLove {
 			slog.Info("Would love", "artist", track.Artist, "title", track.Track, "mbid", track.TrackMBID, "destination", name)
 		}
@@ -189,6 +557,8 @@ func sync(name string, dest model.Source, sourceTracks []model.LovedTrack) error
 		return nil
 	}
 
+	learned.Record(segment.Pairs)
+
 	if err := dest.Love(toLove); err != nil {
 		return fmt.Errorf("failed to love tracks: %w", err)
 	}
@@ -199,5 +569,181 @@ func sync(name string, dest model.Source, sourceTracks []model.LovedTrack) error
 		}
 	}
 
+	// Pairings are only remembered once the destination reflects them
+	pairings.Replace(pairingNamespace(name), segment.Pairs)
+	return nil
+}
+
+// syncRatings rates tracks on the destination, if it supports ratings. If
+// ratings are being synced, the source's ratings are copied; if loved-rating
+// is set, loved tracks that aren't rated on either side are given that rating.
+// Ratings that either side can't give are left alone.
+func syncRatings(name string, src, dest model.Source, sourceRated, sourceLoved []model.LovedTrack) error {
+	rater, ok := dest.(model.RatingSource)
+	if !ok {
+		return nil
+	}
+
+	destRated, err := ratedTracks(rater)
+	if err != nil {
+		return fmt.Errorf("failed to get rated tracks: %w", err)
+	}
+
+	// Pairings are only kept for loved tracks, so aren't used or updated here
+	opts := matchOptions(name)
+
+	var toRate []model.LovedTrack
+	keep := make(map[string]bool)
+	if *lovedRating > 0 && model.CanRate(rater, *lovedRating) {
+		var unrated []model.LovedTrack
+		for _, track := range sourceLoved {
+			if track.Rating == 0 {
+				unrated = append(unrated, track)
+			}
+		}
+
+		segment := matcher.Segment(unrated, destRated, opts...)
+		for _, track := range segment.Missing {
+			track.Rating = *lovedRating
+			toRate = append(toRate, track)
+		}
+		for _, pair := range segment.Pairs {
+			keep[pair.Actual.Identity()] = true
+		}
+	}
+
+	var toUnrate []model.LovedTrack
+	if syncKinds["ratings"] {
+		// Tracks rated in a way the other side can't hold would never match
+		unsupported := func(track model.LovedTrack) bool {
+			return !model.CanRate(src, track.Rating) || !model.CanRate(rater, track.Rating)
+		}
+		desired := slices.DeleteFunc(slices.Clone(sourceRated), unsupported)
+		actual := slices.DeleteFunc(slices.Clone(destRated), unsupported)
+
+		segment := matcher.Segment(desired, actual, opts...)
+		toRate = append(toRate, segment.Missing...)
+		for _, pair := range segment.Pairs {
+			if pair.Desired.Rating != pair.Actual.Rating {
+				toRate = append(toRate, pair.Desired)
+			}
+		}
+
+		if *removeOther {
+			for _, track := range segment.Extra {
+				// Ratings given to loved tracks because of loved-rating are left alone
+				if !keep[track.Identity()] {
+					track.Rating = 0
+					toUnrate = append(toUnrate, track)
+				}
+			}
+		}
+	}
+
+	slog.Info(
+		"Calculated rating differences",
+		"destination", name,
+		"destination_count", len(destRated),
+		"to_rate", len(toRate),
+		"to_unrate", len(toUnrate),
+		"source", *source,
+		"source_count", len(sourceRated),
+	)
+
+	if *dryRun {
+		for _, track := range toRate {
+			slog.Info("Would rate", "artist", track.Artist, "title", track.Track, "rating", track.Rating, "destination", name)
+		}
+		for _, track := range toUnrate {
+			slog.Info("Would remove rating", "artist", track.Artist, "title", track.Track, "destination", name)
+		}
+		return nil
+	}
+
+	if err := rater.Rate(append(toRate, toUnrate...)); err != nil {
+		return fmt.Errorf("failed to rate tracks: %w", err)
+	}
+
+	return nil
+}
+
+// syncAlbums loves the source's albums on the destination, if it supports
+// loving albums
+func syncAlbums(name string, dest model.Source, sourceAlbums []model.LovedAlbum) error {
+	albums, ok := albumSource(dest)
+	if !ok {
+		return nil
+	}
+
+	destAlbums, err := albums.LovedAlbums()
+	if err != nil {
+		return fmt.Errorf("failed to get loved albums: %w", err)
+	}
+
+	segment := matcher.SegmentAlbums(sourceAlbums, destAlbums, matchOptions(name)...)
+	return syncEntities("albums", name, segment, albums.LoveAlbums, albums.UnloveAlbums, func(album model.LovedAlbum) []any {
+		return []any{"artist", album.Artist, "album", album.Title, "mbid", album.MBID}
+	})
+}
+
+// syncArtists loves the source's artists on the destination, if it supports
+// loving artists
+func syncArtists(name string, dest model.Source, sourceArtists []model.LovedArtist) error {
+	artists, ok := artistSource(dest)
+	if !ok {
+		return nil
+	}
+
+	destArtists, err := artists.LovedArtists()
+	if err != nil {
+		return fmt.Errorf("failed to get loved artists: %w", err)
+	}
+
+	segment := matcher.SegmentArtists(sourceArtists, destArtists, matchOptions(name)...)
+	return syncEntities("artists", name, segment, artists.LoveArtists, artists.UnloveArtists, func(artist model.LovedArtist) []any {
+		return []any{"artist", artist.Name, "mbid", artist.MBID}
+	})
+}
+
+// syncEntities applies the differences between the source's and a
+// destination's albums or artists. describe returns the attributes used to
+// log each one.
+func syncEntities[T any](kind, name string, segment matcher.EntityResult[T], love, unlove func([]T) error, describe func(T) []any) error {
+	toLove := segment.Missing
+	var toUnlove []T
+	if *removeOther {
+		toUnlove = segment.Extra
+	}
+
+	slog.Info(
+		"Calculated differences",
+		"kind", kind,
+		"destination", name,
+		"matched", len(segment.Matched),
+		"to_add", len(toLove),
+		"to_remove", len(toUnlove),
+		"source", *source,
+	)
+
+	if *dryRun {
+		for _, entity := range toLove {
+			slog.Info("Would love", append(describe(entity), "destination", name)...)
+		}
+		for _, entity := range toUnlove {
+			slog.Info("Would unlove", append(describe(entity), "destination", name)...)
+		}
+		return nil
+	}
+
+	if err := love(toLove); err != nil {
+		return fmt.Errorf("failed to love %s: %w", kind, err)
+	}
+
+	if *removeOther {
+		if err := unlove(toUnlove); err != nil {
+			return fmt.Errorf("failed to unlove %s: %w", kind, err)
+		}
+	}
+
 	return nil
 }
@@ -0,0 +1,159 @@
+package matcher
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"slices"
+	"sync"
+
+	"github.com/csmith/musiclover/model"
+	"gopkg.in/yaml.v3"
+)
+
+// Aliases records alternative names for artists, such as names in other
+// scripts or names they've previously used. It is safe for concurrent use, and
+// a nil Aliases knows no aliases.
+type Aliases struct {
+	mu sync.RWMutex
+	// groups maps each normalised name to the artists that use it
+	groups map[string][]string
+}
+
+// musicBrainzArtist is a single line of a MusicBrainz JSON artist dump
+type musicBrainzArtist struct {
+	ID      string `json:"id"`
+	Name    string `json:"name"`
+	Aliases []struct {
+		Name string `json:"name"`
+	} `json:"aliases"`
+}
+
+// Add records that all the given names refer to the same artist. The artist
+// parameter identifies it, so that names shared by several artists aren't
+// treated as aliases of each other.
+func (a *Aliases) Add(artist string, names ...string) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if a.groups == nil {
+		a.groups = make(map[string][]string)
+	}
+
+	for _, name := range names {
+		key := normalizeForMatching(name)
+		if key != "" && !slices.Contains(a.groups[key], artist) {
+			a.groups[key] = append(a.groups[key], artist)
+		}
+	}
+}
+
+// Load reads user-defined aliases from a YAML or JSON file, mapping each
+// artist's name to a list of its other names
+func (a *Aliases) Load(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("failed to read aliases: %w", err)
+	}
+
+	var entries map[string][]string
+	if err := yaml.Unmarshal(data, &entries); err != nil {
+		return fmt.Errorf("failed to parse aliases: %w", err)
+	}
+
+	for name, others := range entries {
+		a.Add("user:"+name, append([]string{name}, others...)...)
+	}
+	return nil
+}
+
+// LoadMusicBrainzDump reads aliases from a MusicBrainz JSON data dump of
+// artists, which has one artist per line. Artists without aliases are skipped.
+func (a *Aliases) LoadMusicBrainzDump(path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("failed to read MusicBrainz dump: %w", err)
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 0, 64*1024), 16*1024*1024)
+	for scanner.Scan() {
+		var artist musicBrainzArtist
+		if err := json.Unmarshal(scanner.Bytes(), &artist); err != nil {
+			return fmt.Errorf("failed to parse MusicBrainz dump: %w", err)
+		}
+
+		if len(artist.Aliases) == 0 {
+			continue
+		}
+
+		names := []string{artist.Name}
+		for _, alias := range artist.Aliases {
+			names = append(names, alias.Name)
+		}
+		a.Add("mbid:"+artist.ID, names...)
+	}
+	return scanner.Err()
+}
+
+// Same determines whether the two names are known aliases of the same artist
+func (a *Aliases) Same(x, y string) bool {
+	return a.same(x, y, nil)
+}
+
+func (a *Aliases) same(x, y string, n *names) bool {
+	if a == nil || x == y {
+		return false
+	}
+
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+
+	if len(a.groups) == 0 {
+		return false
+	}
+
+	x, y = n.forMatching(x), n.forMatching(y)
+	if x == y {
+		return false
+	}
+
+	for _, artist := range a.groups[x] {
+		if slices.Contains(a.groups[y], artist) {
+			return true
+		}
+	}
+	return false
+}
+
+// unify returns a copy of the destination track with any artist names that
+// are aliases of the source track's artists replaced by the source's names,
+// and whether any were replaced. Normalised names are looked up in the given
+// cache.
+func (a *Aliases) unify(source, destination model.LovedTrack, n *names) (model.LovedTrack, bool) {
+	if a == nil {
+		return destination, false
+	}
+
+	replaced := false
+	if a.same(source.Artist, destination.Artist, n) {
+		destination.Artist = source.Artist
+		replaced = true
+	}
+
+	if len(destination.Artists) > 0 {
+		destination.Artists = slices.Clone(destination.Artists)
+		for i := range destination.Artists {
+			for _, credit := range source.Artists {
+				if a.same(credit.Name, destination.Artists[i].Name, n) {
+					destination.Artists[i].Name = credit.Name
+					replaced = true
+				}
+			}
+		}
+	}
+
+	return destination, replaced
+}
@@ -0,0 +1,78 @@
+package matcher
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/csmith/musiclover/model"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAliases_Load(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "aliases.yml")
+	require.NoError(t, os.WriteFile(path, []byte(`
+Prince:
+  - The Artist Formerly Known as Prince
+  - TAFKAP
+`), 0600))
+
+	a := &Aliases{}
+	require.NoError(t, a.Load(path))
+
+	assert.True(t, a.Same("Prince", "The Artist Formerly Known As Prince"))
+	assert.True(t, a.Same("TAFKAP", "the artist formerly known as prince"))
+	assert.False(t, a.Same("Prince", "Madonna"))
+}
+
+func TestAliases_LoadMusicBrainzDump(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "artist")
+	require.NoError(t, os.WriteFile(path, []byte(
+		`{"id": "sakamoto", "name": "坂本龍一", "aliases": [{"name": "Ryuichi Sakamoto"}, {"name": "Ryūichi Sakamoto"}]}
+{"id": "nirvana-us", "name": "Nirvana", "aliases": [{"name": "Nirvana (US)"}]}
+{"id": "nirvana-uk", "name": "Nirvana", "aliases": [{"name": "The Nirvana"}, {"name": "Nirvana UK"}]}
+{"id": "no-aliases", "name": "Someone", "aliases": []}
+`), 0600))
+
+	a := &Aliases{}
+	require.NoError(t, a.LoadMusicBrainzDump(path))
+
+	assert.True(t, a.Same("坂本龍一", "Ryuichi Sakamoto"))
+	assert.True(t, a.Same("Nirvana", "Nirvana UK"))
+	assert.False(t, a.Same("Nirvana UK", "Nirvana US"), "aliases of different artists sharing a name shouldn't be linked")
+}
+
+func TestAliases_Nil(t *testing.T) {
+	var a *Aliases
+	assert.False(t, a.Same("Prince", "TAFKAP"))
+}
+
+func TestFind_WithAliases(t *testing.T) {
+	a := &Aliases{}
+	a.Add("sakamoto", "坂本龍一", "Ryuichi Sakamoto")
+
+	tracks := []model.LovedTrack{
+		{ID: "1", Artist: "坂本龍一", Track: "Merry Christmas Mr. Lawrence", Artists: []model.ArtistCredit{{Name: "坂本龍一"}}},
+		{ID: "2", Artist: "Other", Track: "Other"},
+	}
+	target := model.LovedTrack{Artist: "Ryuichi Sakamoto", Track: "Merry Christmas Mr. Lawrence", Artists: []model.ArtistCredit{{Name: "Ryuichi Sakamoto"}}}
+
+	assert.Equal(t, -1, Find(tracks, target))
+
+	result := Search(tracks, target, WithAliases(a))
+	assert.Equal(t, 0, result.Index)
+	assert.Contains(t, result.Rule, "via artist alias")
+	assert.Greater(t, result.Confidence, 0.9)
+}
+
+func TestMatch_Transliterated(t *testing.T) {
+	assert.Equal(t, FuzzyMatch, Match(
+		model.LovedTrack{Artist: "Кино", Track: "Группа крови"},
+		model.LovedTrack{Artist: "Kino", Track: "Gruppa krovi"},
+	))
+	assert.Equal(t, FuzzyMatch, Match(
+		model.LovedTrack{Artist: "Sigur Rós", Track: "Hoppípolla"},
+		model.LovedTrack{Artist: "Sigur Ros", Track: "Hoppipolla"},
+	))
+}
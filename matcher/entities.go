@@ -0,0 +1,233 @@
+package matcher
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/agnivade/levenshtein"
+	"github.com/csmith/musiclover/model"
+)
+
+// Albums and artists are scored on the same scale as tracks. Their own MBIDs
+// stand in for recording MBIDs, so a matching release or artist MBID scores
+// TrackMBID, and names are compared like tracks' names. Overrides and
+// pairings only apply to tracks.
+
+// EntityPair is a desired album or artist and the actual one it was matched with
+type EntityPair[T any] struct {
+	Desired T
+	Actual  T
+	Explanation
+}
+
+// EntityResult is the outcome of comparing desired albums or artists with
+// actual ones
+type EntityResult[T any] struct {
+	Pairs   []EntityPair[T]
+	Matched []T
+	Missing []T
+	Extra   []T
+}
+
+// ExplainAlbum compares two albums. Albums with the same release MBID match;
+// otherwise their artists and titles are compared, ignoring edition
+// qualifiers such as "Deluxe Edition" so that different releases of the same
+// album are treated alike.
+func ExplainAlbum(a, b model.LovedAlbum, opts ...Option) Explanation {
+	return configFor(opts).explainAlbum(a, b)
+}
+
+// ExplainArtist compares two artists by MBID, or by name if either doesn't
+// have one
+func ExplainArtist(a, b model.LovedArtist, opts ...Option) Explanation {
+	return configFor(opts).explainArtist(a, b)
+}
+
+// SegmentAlbums compares desired albums against actual albums
+func SegmentAlbums(desired, actual []model.LovedAlbum, opts ...Option) EntityResult[model.LovedAlbum] {
+	return segmentEntities(desired, actual, configFor(opts).explainAlbum)
+}
+
+// SegmentArtists compares desired artists against actual artists
+func SegmentArtists(desired, actual []model.LovedArtist, opts ...Option) EntityResult[model.LovedArtist] {
+	return segmentEntities(desired, actual, configFor(opts).explainArtist)
+}
+
+// FindAlbum returns the index of the best matching album, or -1 if none match
+// or several match equally well
+func FindAlbum(albums []model.LovedAlbum, target model.LovedAlbum, opts ...Option) int {
+	return findEntity(albums, target, configFor(opts).explainAlbum)
+}
+
+// FindArtist returns the index of the best matching artist, or -1 if none
+// match or several match equally well
+func FindArtist(artists []model.LovedArtist, target model.LovedArtist, opts ...Option) int {
+	return findEntity(artists, target, configFor(opts).explainArtist)
+}
+
+func (c *config) explainAlbum(a, b model.LovedAlbum) Explanation {
+	if a.MBID != "" && a.MBID == b.MBID {
+		return Explanation{Score: TrackMBID, Rule: "same release MBID", Distance: -1, DurationDifference: -1, Confidence: 1}
+	}
+
+	if a.ArtistMBID != "" && b.ArtistMBID != "" && a.ArtistMBID != b.ArtistMBID {
+		return Explanation{Rule: "different artist MBIDs", Distance: -1, DurationDifference: -1, Rejection: "different artist MBIDs"}
+	}
+
+	sameArtist := a.ArtistMBID != "" && a.ArtistMBID == b.ArtistMBID
+	return c.explainNames(a.Artist, a.Title, b.Artist, b.Title, sameArtist)
+}
+
+func (c *config) explainArtist(a, b model.LovedArtist) Explanation {
+	if a.MBID != "" && b.MBID != "" {
+		if a.MBID == b.MBID {
+			return Explanation{Score: TrackMBID, Rule: "same artist MBID", Distance: -1, DurationDifference: -1, Confidence: 1}
+		}
+		// Different artists often share a name, e.g. the several bands called Nirvana
+		return Explanation{Rule: "different artist MBIDs", Distance: -1, DurationDifference: -1, Rejection: "different artist MBIDs"}
+	}
+
+	return c.explainNames(a.Name, "", b.Name, "", false)
+}
+
+// explainNames compares the artist and title of an album, or just the artist
+// names if the titles are blank. If sameArtist is set, the artists are
+// already known to be the same and their names aren't compared.
+func (c *config) explainNames(artistA, titleA, artistB, titleB string, sameArtist bool) Explanation {
+	e := Explanation{Distance: -1, DurationDifference: -1}
+	if artistA == "" || artistB == "" || (titleA == "") != (titleB == "") {
+		e.Rule = "missing names"
+		return e
+	}
+
+	aliased := !sameArtist && c.aliases.same(artistA, artistB, c.names)
+	if sameArtist || aliased {
+		artistB = artistA
+	}
+
+	e.KeyA, e.KeyB = c.names.forMatching(artistA), c.names.forMatching(artistB)
+	if titleA != "" {
+		e.KeyA += "|" + c.names.album(titleA)
+		e.KeyB += "|" + c.names.album(titleB)
+	}
+	e.Distance = levenshtein.ComputeDistance(e.KeyA, e.KeyB)
+
+	switch {
+	case sameArtist && strings.EqualFold(titleA, titleB):
+		e.Score = ArtistMBID
+		e.Rule = "same artist MBID and album title"
+		e.Confidence = 1
+	case strings.EqualFold(artistA, artistB) && strings.EqualFold(titleA, titleB):
+		e.Score = ExactMatch
+		e.Rule = "same names"
+		e.Confidence = 1
+	case e.KeyA == e.KeyB:
+		e.Score = FuzzyMatch
+		e.Rule = "same normalised names"
+		e.Confidence = similarity(e.KeyA, e.KeyB)
+	case e.Distance <= maxLevenshteinDistance:
+		e.Score = FuzzyMatch
+		e.Rule = fmt.Sprintf("normalised names within distance %d", maxLevenshteinDistance)
+		e.Confidence = similarity(e.KeyA, e.KeyB)
+	default:
+		e.Rule = "no rule matched"
+		return e
+	}
+
+	if aliased {
+		e.Rule += ", via artist alias"
+	}
+
+	if e.Score < ISRC && e.Confidence < c.minConfidence {
+		e.Rule = fmt.Sprintf("%s, but confidence %s is below %s", e.Rule, FormatConfidence(e.Confidence), FormatConfidence(c.minConfidence))
+		e.Rejection = fmt.Sprintf("%s below confidence threshold", e.Score)
+		e.Score = NoMatch
+	}
+	return e
+}
+
+// segmentEntities pairs up desired and actual albums or artists, best matches
+// first
+func segmentEntities[T any](desired, actual []T, explain func(a, b T) Explanation) EntityResult[T] {
+	result := EntityResult[T]{
+		Pairs:   make([]EntityPair[T], 0),
+		Matched: make([]T, 0),
+		Missing: make([]T, 0),
+		Extra:   make([]T, 0),
+	}
+
+	var candidates []matchCandidate
+	for i := range desired {
+		for j := range actual {
+			if explanation := explain(desired[i], actual[j]); explanation.Score != NoMatch {
+				candidates = append(candidates, matchCandidate{desiredIndex: i, actualIndex: j, explanation: explanation})
+			}
+		}
+	}
+
+	sort.SliceStable(candidates, func(i, j int) bool {
+		return better(candidates[i].explanation, candidates[j].explanation)
+	})
+
+	matchedDesired := make(map[int]bool)
+	matchedActual := make(map[int]bool)
+	for _, candidate := range candidates {
+		if !matchedDesired[candidate.desiredIndex] && !matchedActual[candidate.actualIndex] {
+			matchedDesired[candidate.desiredIndex] = true
+			matchedActual[candidate.actualIndex] = true
+			result.Pairs = append(result.Pairs, EntityPair[T]{
+				Desired:     desired[candidate.desiredIndex],
+				Actual:      actual[candidate.actualIndex],
+				Explanation: candidate.explanation,
+			})
+		}
+	}
+
+	for i := range desired {
+		if matchedDesired[i] {
+			result.Matched = append(result.Matched, desired[i])
+		} else {
+			result.Missing = append(result.Missing, desired[i])
+		}
+	}
+
+	for j := range actual {
+		if !matchedActual[j] {
+			result.Extra = append(result.Extra, actual[j])
+		}
+	}
+
+	return result
+}
+
+// findEntity returns the index of the album or artist that best matches the
+// target, or -1 if none match or the best can't be told apart from another
+func findEntity[T any](entities []T, target T, explain func(a, b T) Explanation) int {
+	best, bestExplanation := -1, Explanation{}
+	ambiguous := false
+	for i := range entities {
+		explanation := explain(target, entities[i])
+		if explanation.Score == NoMatch {
+			continue
+		}
+
+		switch {
+		case best == -1 || better(explanation, bestExplanation) && !tiedWith(explanation, bestExplanation):
+			best, bestExplanation, ambiguous = i, explanation, false
+		case tiedWith(explanation, bestExplanation):
+			ambiguous = true
+		}
+	}
+
+	if ambiguous {
+		return -1
+	}
+	return best
+}
+
+// tiedWith determines whether two explanations are equally good, allowing for
+// a small difference in confidence
+func tiedWith(a, b Explanation) bool {
+	return a.Score == b.Score && a.Confidence-b.Confidence <= ambiguityMargin && b.Confidence-a.Confidence <= ambiguityMargin
+}
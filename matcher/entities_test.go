@@ -0,0 +1,143 @@
+package matcher
+
+import (
+	"testing"
+
+	"github.com/csmith/musiclover/model"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestExplainAlbum(t *testing.T) {
+	tests := []struct {
+		name     string
+		a, b     model.LovedAlbum
+		expected Score
+	}{
+		{
+			name:     "same release MBID",
+			a:        model.LovedAlbum{Artist: "Artist", Title: "Album", MBID: "mbid-1"},
+			b:        model.LovedAlbum{Artist: "Someone", Title: "Other", MBID: "mbid-1"},
+			expected: TrackMBID,
+		},
+		{
+			name:     "same names",
+			a:        model.LovedAlbum{Artist: "Artist", Title: "Album"},
+			b:        model.LovedAlbum{Artist: "artist", Title: "album"},
+			expected: ExactMatch,
+		},
+		{
+			name:     "different releases of the same album",
+			a:        model.LovedAlbum{Artist: "Artist", Title: "Album", MBID: "mbid-1"},
+			b:        model.LovedAlbum{Artist: "Artist", Title: "Album (Deluxe Edition)", MBID: "mbid-2"},
+			expected: FuzzyMatch,
+		},
+		{
+			name:     "same artist MBID",
+			a:        model.LovedAlbum{Artist: "Artist", Title: "Album", ArtistMBID: "artist-1"},
+			b:        model.LovedAlbum{Artist: "The Artist Formerly Known", Title: "Album", ArtistMBID: "artist-1"},
+			expected: ArtistMBID,
+		},
+		{
+			name:     "different artist MBIDs",
+			a:        model.LovedAlbum{Artist: "Artist", Title: "Album", ArtistMBID: "artist-1"},
+			b:        model.LovedAlbum{Artist: "Artist", Title: "Album", ArtistMBID: "artist-2"},
+			expected: NoMatch,
+		},
+		{
+			name:     "different titles",
+			a:        model.LovedAlbum{Artist: "Artist", Title: "First Album"},
+			b:        model.LovedAlbum{Artist: "Artist", Title: "Second Album"},
+			expected: NoMatch,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.expected, ExplainAlbum(tt.a, tt.b).Score)
+		})
+	}
+}
+
+func TestExplainArtist(t *testing.T) {
+	assert.Equal(t, TrackMBID, ExplainArtist(
+		model.LovedArtist{Name: "Artist", MBID: "mbid-1"},
+		model.LovedArtist{Name: "Other", MBID: "mbid-1"},
+	).Score)
+	assert.Equal(t, NoMatch, ExplainArtist(
+		model.LovedArtist{Name: "Nirvana", MBID: "mbid-1"},
+		model.LovedArtist{Name: "Nirvana", MBID: "mbid-2"},
+	).Score)
+	assert.Equal(t, ExactMatch, ExplainArtist(
+		model.LovedArtist{Name: "Nirvana", MBID: "mbid-1"},
+		model.LovedArtist{Name: "nirvana"},
+	).Score)
+	assert.Equal(t, FuzzyMatch, ExplainArtist(
+		model.LovedArtist{Name: "The Beatles"},
+		model.LovedArtist{Name: "Beatles"},
+	).Score)
+}
+
+func TestExplainArtist_Aliases(t *testing.T) {
+	a := &Aliases{}
+	a.Add("prince", "Prince", "The Artist Formerly Known as Prince")
+
+	explanation := ExplainArtist(
+		model.LovedArtist{Name: "Prince"},
+		model.LovedArtist{Name: "The Artist Formerly Known as Prince"},
+		WithAliases(a),
+	)
+	assert.Equal(t, ExactMatch, explanation.Score)
+	assert.Contains(t, explanation.Rule, "via artist alias")
+}
+
+func TestSegmentAlbums(t *testing.T) {
+	desired := []model.LovedAlbum{
+		{Artist: "Artist", Title: "Album One", MBID: "mbid-1"},
+		{Artist: "Artist", Title: "Album Two"},
+		{Artist: "Artist", Title: "Album Three"},
+	}
+	actual := []model.LovedAlbum{
+		{ID: "1", Artist: "Artist", Title: "Album One (Remastered)", MBID: "mbid-1"},
+		{ID: "2", Artist: "Artist", Title: "Album Two"},
+		{ID: "3", Artist: "Artist", Title: "Album Four Hundred"},
+	}
+
+	result := SegmentAlbums(desired, actual)
+
+	assert.Equal(t, []model.LovedAlbum{desired[0], desired[1]}, result.Matched)
+	assert.Equal(t, []model.LovedAlbum{desired[2]}, result.Missing)
+	assert.Equal(t, []model.LovedAlbum{actual[2]}, result.Extra)
+	assert.Len(t, result.Pairs, 2)
+	assert.Equal(t, actual[0], result.Pairs[0].Actual)
+	assert.Equal(t, TrackMBID, result.Pairs[0].Score)
+}
+
+func TestSegmentArtists_MinConfidence(t *testing.T) {
+	desired := []model.LovedArtist{{Name: "Artist"}}
+	actual := []model.LovedArtist{{Name: "Artsit"}}
+
+	assert.Len(t, SegmentArtists(desired, actual).Pairs, 1)
+	assert.Len(t, SegmentArtists(desired, actual, WithMinConfidence(0.99)).Missing, 1)
+}
+
+func TestFindAlbum(t *testing.T) {
+	albums := []model.LovedAlbum{
+		{ID: "1", Artist: "Artist", Title: "Other Album"},
+		{ID: "2", Artist: "Artist", Title: "Album"},
+		{ID: "3", Artist: "Artist", Title: "Album (Deluxe Edition)"},
+	}
+
+	assert.Equal(t, 1, FindAlbum(albums, model.LovedAlbum{Artist: "Artist", Title: "Album"}))
+	assert.Equal(t, -1, FindAlbum(albums, model.LovedAlbum{Artist: "Artist", Title: "Album (Expanded Edition)"}))
+	assert.Equal(t, -1, FindAlbum(albums, model.LovedAlbum{Artist: "Artist", Title: "Unknown"}))
+}
+
+func TestFindArtist(t *testing.T) {
+	artists := []model.LovedArtist{
+		{ID: "1", Name: "Nirvana", MBID: "mbid-1"},
+		{ID: "2", Name: "Nirvana", MBID: "mbid-2"},
+	}
+
+	assert.Equal(t, 1, FindArtist(artists, model.LovedArtist{Name: "Nirvana", MBID: "mbid-2"}))
+	assert.Equal(t, -1, FindArtist(artists, model.LovedArtist{Name: "Nirvana"}))
+}
@@ -0,0 +1,164 @@
+package matcher
+
+import (
+	_ "embed"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/csmith/musiclover/model"
+	"gopkg.in/yaml.v3"
+)
+
+//go:embed corpus/starter.yml
+var starterCorpus []byte
+
+// Case is a labelled pair of tracks in an evaluation corpus
+type Case struct {
+	// Note describes the case, to help identify it in reports
+	Note string `yaml:"note"`
+	// Same is whether the tracks are really the same recording
+	Same bool        `yaml:"same"`
+	A    CorpusTrack `yaml:"a"`
+	B    CorpusTrack `yaml:"b"`
+}
+
+// CorpusTrack describes a track in an evaluation corpus
+type CorpusTrack struct {
+	ID         string               `yaml:"id"`
+	Artist     string               `yaml:"artist"`
+	Title      string               `yaml:"title"`
+	Album      string               `yaml:"album"`
+	MBID       string               `yaml:"mbid"`
+	ArtistMBID string               `yaml:"artist_mbid"`
+	AlbumMBID  string               `yaml:"album_mbid"`
+	ISRCs      []string             `yaml:"isrcs"`
+	Duration   time.Duration        `yaml:"duration"`
+	Artists    []model.ArtistCredit `yaml:"artists"`
+}
+
+// LovedTrack converts the corpus track to a LovedTrack
+func (t CorpusTrack) LovedTrack() model.LovedTrack {
+	return model.LovedTrack{
+		ID:         t.ID,
+		Track:      t.Title,
+		Artist:     t.Artist,
+		Album:      t.Album,
+		TrackMBID:  t.MBID,
+		ArtistMBID: t.ArtistMBID,
+		AlbumMBID:  t.AlbumMBID,
+		ISRCs:      t.ISRCs,
+		Duration:   t.Duration,
+		Artists:    t.Artists,
+	}
+}
+
+// LoadCorpus reads evaluation cases from a YAML or JSON file
+func LoadCorpus(path string) ([]Case, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read corpus: %w", err)
+	}
+	return parseCorpus(data)
+}
+
+// StarterCorpus returns the cases in the corpus bundled with musiclover
+func StarterCorpus() ([]Case, error) {
+	return parseCorpus(starterCorpus)
+}
+
+func parseCorpus(data []byte) ([]Case, error) {
+	var cases []Case
+	if err := yaml.Unmarshal(data, &cases); err != nil {
+		return nil, fmt.Errorf("failed to parse corpus: %w", err)
+	}
+	return cases, nil
+}
+
+// Outcome is the result of evaluating a single case
+type Outcome struct {
+	Case
+	// Matched is whether the matcher paired the tracks
+	Matched bool
+	// Explanation describes how the tracks were scored
+	Explanation
+}
+
+// Report summarises how the matcher performed against a corpus
+type Report struct {
+	TruePositives, FalsePositives, TrueNegatives, FalseNegatives int
+	// FalsePositivesByScore groups the wrong matches by the score the matcher
+	// gave the tracks
+	FalsePositivesByScore map[Score][]Outcome
+	// FalseNegativesByReason groups the missed matches by what rejected them,
+	// such as conflicting durations or too little confidence in a match
+	FalseNegativesByReason map[string][]Outcome
+	// MatchesByScore counts all the pairs the matcher made, by score
+	MatchesByScore map[Score]int
+}
+
+// Precision is the proportion of matches that were correct, or 1 if nothing matched
+func (r Report) Precision() float64 {
+	if r.TruePositives+r.FalsePositives == 0 {
+		return 1
+	}
+	return float64(r.TruePositives) / float64(r.TruePositives+r.FalsePositives)
+}
+
+// Recall is the proportion of same tracks that were matched, or 1 if there were none
+func (r Report) Recall() float64 {
+	if r.TruePositives+r.FalseNegatives == 0 {
+		return 1
+	}
+	return float64(r.TruePositives) / float64(r.TruePositives+r.FalseNegatives)
+}
+
+// Evaluate runs Segment over each case in the corpus, and reports how often
+// the matcher agreed with the labels
+func Evaluate(cases []Case, opts ...Option) Report {
+	report := Report{
+		FalsePositivesByScore:  make(map[Score][]Outcome),
+		FalseNegativesByReason: make(map[string][]Outcome),
+		MatchesByScore:         make(map[Score]int),
+	}
+
+	for _, c := range cases {
+		a, b := c.A.LovedTrack(), c.B.LovedTrack()
+		outcome := Outcome{Case: c}
+
+		result := Segment([]model.LovedTrack{a}, []model.LovedTrack{b}, opts...)
+		if len(result.Pairs) > 0 {
+			outcome.Matched = true
+			outcome.Explanation = result.Pairs[0].Explanation
+			report.MatchesByScore[outcome.Score]++
+		} else {
+			outcome.Explanation = configFor(opts).explain(a, b)
+		}
+
+		switch {
+		case c.Same && outcome.Matched:
+			report.TruePositives++
+		case c.Same:
+			report.FalseNegatives++
+			reason := outcome.reason()
+			report.FalseNegativesByReason[reason] = append(report.FalseNegativesByReason[reason], outcome)
+		case outcome.Matched:
+			report.FalsePositives++
+			report.FalsePositivesByScore[outcome.Score] = append(report.FalsePositivesByScore[outcome.Score], outcome)
+		default:
+			report.TrueNegatives++
+		}
+	}
+
+	return report
+}
+
+// reason describes why the tracks in the outcome weren't matched: the rule or
+// threshold that rejected them if there was one, or otherwise the rule that
+// decided their score, which is "no rule matched" if nothing applied
+func (o Outcome) reason() string {
+	if o.Rejection != "" {
+		return o.Rejection
+	}
+	return o.Rule
+}
@@ -0,0 +1,103 @@
+package matcher
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEvaluate_StarterCorpus(t *testing.T) {
+	cases, err := StarterCorpus()
+	require.NoError(t, err)
+	require.NotEmpty(t, cases)
+
+	report := Evaluate(cases)
+	for _, outcomes := range report.FalsePositivesByScore {
+		for _, outcome := range outcomes {
+			t.Errorf("false positive: %s (%s)", outcome.Note, outcome.Rule)
+		}
+	}
+	for _, outcomes := range report.FalseNegativesByReason {
+		for _, outcome := range outcomes {
+			t.Errorf("false negative: %s (%s)", outcome.Note, outcome.Rule)
+		}
+	}
+	assert.Equal(t, 1.0, report.Precision())
+	assert.Equal(t, 1.0, report.Recall())
+}
+
+func TestEvaluate(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "corpus.yml")
+	require.NoError(t, os.WriteFile(path, []byte(`
+- note: same by MBID
+  same: true
+  a: {artist: Artist, title: Song, mbid: mbid-1}
+  b: {artist: Artist, title: Song, mbid: mbid-1}
+- note: same by name
+  same: true
+  a: {artist: Artist, title: Song, duration: 3m}
+  b: {artist: The Artist, title: Song (Remastered)}
+- note: remix
+  same: false
+  a: {artist: Artist, title: Song}
+  b: {artist: Artist, title: Song (Remix)}
+- note: different
+  same: false
+  a: {artist: Artist, title: Song}
+  b: {artist: Artist, title: Other}
+`), 0600))
+
+	cases, err := LoadCorpus(path)
+	require.NoError(t, err)
+	require.Len(t, cases, 4)
+	assert.Equal(t, 3*time.Minute, cases[1].A.LovedTrack().Duration)
+
+	report := Evaluate(cases)
+	assert.Equal(t, 2, report.TruePositives)
+	assert.Equal(t, 1, report.FalsePositives)
+	assert.Equal(t, 1, report.TrueNegatives)
+	assert.Equal(t, 0, report.FalseNegatives)
+	assert.Equal(t, "remix", report.FalsePositivesByScore[FuzzyMatch][0].Note)
+	assert.InDelta(t, 2.0/3, report.Precision(), 0.001)
+	assert.Equal(t, 1.0, report.Recall())
+
+	strict := Evaluate(cases, WithMatcher(Pipeline{TrackMBIDRule}))
+	assert.Equal(t, 1, strict.TruePositives)
+	assert.Equal(t, 1, strict.FalseNegatives)
+	assert.Equal(t, "same by name", strict.FalseNegativesByReason["no rule matched"][0].Note)
+	assert.Equal(t, 1.0, strict.Precision())
+	assert.Equal(t, 0.5, strict.Recall())
+}
+
+func TestEvaluate_GroupsFalseNegativesByRejection(t *testing.T) {
+	cases := []Case{
+		{
+			Note: "long version",
+			Same: true,
+			A:    CorpusTrack{Artist: "Artist", Title: "Song", Duration: 3 * time.Minute},
+			B:    CorpusTrack{Artist: "Artist", Title: "Song", Duration: 10 * time.Minute},
+		},
+		{
+			Note: "typo",
+			Same: true,
+			A:    CorpusTrack{Artist: "Artist", Title: "Song"},
+			B:    CorpusTrack{Artist: "Artist", Title: "Sang"},
+		},
+		{
+			Note: "unrelated names",
+			Same: true,
+			A:    CorpusTrack{Artist: "Artist", Title: "Song"},
+			B:    CorpusTrack{Artist: "Someone", Title: "Else"},
+		},
+	}
+
+	report := Evaluate(cases, WithMinConfidence(0.99))
+	require.Equal(t, 3, report.FalseNegatives)
+	assert.Equal(t, "long version", report.FalseNegativesByReason["durations conflict"][0].Note)
+	assert.Equal(t, "typo", report.FalseNegativesByReason["FuzzyMatch below confidence threshold"][0].Note)
+	assert.Equal(t, "unrelated names", report.FalseNegativesByReason["no rule matched"][0].Note)
+}
@@ -1,20 +1,151 @@
 package matcher
 
-import "github.com/csmith/musiclover/model"
+import (
+	"sort"
+
+	"github.com/csmith/musiclover/model"
+)
+
+// ambiguityMargin is how close two candidates' confidences must be for them
+// to be considered equally good
+const ambiguityMargin = 0.005
+
+// Result describes the outcome of searching for a track
+type Result struct {
+	// Index is the position of the best match, or -1 if there isn't one
+	Index int
+	// Explanation describes how the best match was scored
+	Explanation
+	// Ambiguous holds the positions of equally good candidates that couldn't be
+	// told apart by the tie-breakers. If it's non-empty, Index is -1.
+	Ambiguous []int
+}
 
 // Find searches for the best matching track in a slice
-// Returns the index of the best match, or -1 if no match is found
-func Find(tracks []model.LovedTrack, target model.LovedTrack) int {
-	bestIndex := -1
-	bestScore := NoMatch
+// Returns the index of the best match, or -1 if no match is found or if
+// several tracks match equally well
+func Find(tracks []model.LovedTrack, target model.LovedTrack, opts ...Option) int {
+	return Search(tracks, target, opts...).Index
+}
+
+// Search looks for the best matching track in a slice. If several tracks
+// match equally well, the configured tie-breakers are used to choose between
+// them; if they can't, no match is made and the candidates are reported as
+// ambiguous.
+func Search(tracks []model.LovedTrack, target model.LovedTrack, opts ...Option) Result {
+	c := configFor(opts)
+	return c.search(tracks, target, lazyIdentities(tracks))
+}
+
+// SearchEach searches the tracks for each of the targets in turn, as Search
+// does. It's cheaper than calling Search for each target, as the tracks are
+// only prepared once.
+func SearchEach(tracks []model.LovedTrack, targets []model.LovedTrack, opts ...Option) []Result {
+	c := configFor(opts)
+	identities := lazyIdentities(tracks)
+
+	results := make([]Result, len(targets))
+	for i := range targets {
+		results[i] = c.search(tracks, targets[i], identities)
+	}
+	return results
+}
 
+func (c *config) search(tracks []model.LovedTrack, target model.LovedTrack, identities func() identityIndex) Result {
+	result := Result{Index: -1}
+	if c.overrides.ignored(target, c.names) {
+		return result
+	}
+
+	if index, explanation, ok := c.remembered(target, tracks, identities, func(i int) bool { return !c.overrides.ignored(tracks[i], c.names) }); ok {
+		result.Index = index
+		result.Explanation = explanation
+		return result
+	}
+
+	// Any pairing that wasn't found is stale
+	c.pairings.Forget(c.namespace, target.Identity())
+
+	var candidates []Candidate
 	for i := range tracks {
-		score := Match(tracks[i], target)
-		if score > bestScore {
-			bestScore = score
-			bestIndex = i
+		if c.overrides.ignored(tracks[i], c.names) {
+			continue
+		}
+
+		if explanation := c.explain(target, tracks[i]); explanation.Score != NoMatch {
+			candidates = append(candidates, Candidate{Index: i, Explanation: explanation})
+		}
+	}
+
+	if len(candidates) == 0 {
+		return result
+	}
+
+	sort.SliceStable(candidates, func(i, j int) bool {
+		return better(candidates[i].Explanation, candidates[j].Explanation)
+	})
+
+	// Copies of the same track (e.g. appearing twice in a listing) don't count
+	// as separate candidates
+	tied := candidates[:1:1]
+	seen := map[string]bool{tracks[candidates[0].Index].Identity(): true}
+	for _, candidate := range candidates[1:] {
+		identity := tracks[candidate.Index].Identity()
+		if candidate.Score == candidates[0].Score && candidates[0].Confidence-candidate.Confidence <= ambiguityMargin && !seen[identity] {
+			seen[identity] = true
+			tied = append(tied, candidate)
+		}
+	}
+	tied = c.breakTies(target, tracks, tied)
+
+	if len(tied) > 1 && !c.allCopies(tracks, tied) {
+		for _, candidate := range tied {
+			result.Ambiguous = append(result.Ambiguous, candidate.Index)
 		}
+		return result
 	}
 
-	return bestIndex
+	result.Index = tied[0].Index
+	result.Explanation = tied[0].Explanation
+	c.pairings.Record(c.namespace, target.Identity(), tracks[result.Index].Identity())
+	return result
+}
+
+// allCopies determines whether every tied candidate is a copy of the first
+func (c *config) allCopies(tracks []model.LovedTrack, tied []Candidate) bool {
+	if c.duplicates == NoMatch {
+		return false
+	}
+
+	for _, candidate := range tied[1:] {
+		if !c.copies(c.explain(tracks[tied[0].Index], tracks[candidate.Index]).Score) {
+			return false
+		}
+	}
+	return true
+}
+
+// Copies finds the other tracks that are copies of the chosen one, according
+// to WithDuplicates. If no duplicates score is configured, there are never
+// any copies.
+func Copies(tracks []model.LovedTrack, chosen int, opts ...Option) []int {
+	c := configFor(opts)
+	if c.duplicates == NoMatch {
+		return nil
+	}
+
+	var copies []int
+	seen := map[string]bool{tracks[chosen].Identity(): true}
+	for i := range tracks {
+		identity := tracks[i].Identity()
+		if seen[identity] || c.overrides.ignored(tracks[i], c.names) {
+			continue
+		}
+
+		if c.copies(c.explain(tracks[chosen], tracks[i]).Score) {
+			seen[identity] = true
+			copies = append(copies, i)
+		}
+	}
+	return copies
 }
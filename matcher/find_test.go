@@ -2,6 +2,7 @@ package matcher
 
 import (
 	"testing"
+	"time"
 
 	"github.com/csmith/musiclover/model"
 	"github.com/stretchr/testify/assert"
@@ -111,6 +112,49 @@ func TestFind(t *testing.T) {
 			},
 			expectedIndex: intPtr(1),
 		},
+		{
+			name: "prefers most confident fuzzy match",
+			tracks: []model.LovedTrack{
+				{
+					Track:  "Song Nmae",
+					Artist: "Artist",
+				},
+				{
+					Track:  "Song Name (Live)",
+					Artist: "Artist",
+				},
+			},
+			target: model.LovedTrack{
+				Track:  "Song Name",
+				Artist: "Artist",
+			},
+			expectedIndex: intPtr(1),
+		},
+		{
+			name: "prefers closest duration between equal matches",
+			tracks: []model.LovedTrack{
+				{
+					Track:    "Song",
+					Artist:   "Artist",
+					Duration: 3*time.Minute + 20*time.Second,
+				},
+				{
+					Track:    "Song",
+					Artist:   "Artist",
+					Duration: 3*time.Minute + 2*time.Second,
+				},
+				{
+					Track:  "Song",
+					Artist: "Artist",
+				},
+			},
+			target: model.LovedTrack{
+				Track:    "Song",
+				Artist:   "Artist",
+				Duration: 3 * time.Minute,
+			},
+			expectedIndex: intPtr(1),
+		},
 	}
 
 	for _, tt := range tests {
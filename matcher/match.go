@@ -1,7 +1,10 @@
 package matcher
 
 import (
+	"fmt"
+	"regexp"
 	"strings"
+	"time"
 
 	"github.com/agnivade/levenshtein"
 	"github.com/csmith/musiclover/model"
@@ -16,64 +19,354 @@ const (
 	ExactMatch      Score = 2
 	ArtistMBID      Score = 3
 	AlbumArtistMBID Score = 4
-	TrackMBID       Score = 5
+	ISRC            Score = 5
+	TrackMBID       Score = 6
+	Override        Score = 7
 )
 
 const maxLevenshteinDistance = 3
 
+// Tracks whose durations differ by more than both of these are considered
+// different recordings, even if their names match.
+const (
+	maxDurationDifference      = 30 * time.Second
+	maxDurationDifferenceRatio = 0.15
+)
+
+// String returns a human-readable name for the score
+func (s Score) String() string {
+	switch s {
+	case NoMatch:
+		return "NoMatch"
+	case FuzzyMatch:
+		return "FuzzyMatch"
+	case ExactMatch:
+		return "ExactMatch"
+	case ArtistMBID:
+		return "ArtistMBID"
+	case AlbumArtistMBID:
+		return "AlbumArtistMBID"
+	case ISRC:
+		return "ISRC"
+	case TrackMBID:
+		return "TrackMBID"
+	case Override:
+		return "Override"
+	default:
+		return fmt.Sprintf("Score(%d)", int(s))
+	}
+}
+
+// ParseScore returns the score with the given name, as returned by String.
+// Names are case-insensitive.
+func ParseScore(name string) (Score, error) {
+	for s := NoMatch; s <= Override; s++ {
+		if strings.EqualFold(s.String(), name) {
+			return s, nil
+		}
+	}
+	return NoMatch, fmt.Errorf("unknown score: %s", name)
+}
+
+// Explanation describes how a match between two tracks was decided
+type Explanation struct {
+	Score Score
+	// Rule describes the rule that determined the score
+	Rule string
+	// KeyA and KeyB are the normalised artist and track names that are compared for fuzzy matches
+	KeyA, KeyB string
+	// Distance is the Levenshtein distance between KeyA and KeyB, or -1 if either track lacks names
+	Distance int
+	// DurationDifference is the absolute difference in track lengths, or -1 if either is unknown
+	DurationDifference time.Duration
+	// Confidence is how likely the tracks are to be the same recording, from 0 to 1
+	Confidence float64
+	// Rejection says what stopped the tracks from matching when a rule or
+	// threshold ruled them out, such as conflicting durations. It's empty if
+	// they matched, or nothing applied to them.
+	Rejection string
+
+	// names caches normalised names while the explanation is being worked out
+	names *names
+}
+
 // Match compares two LovedTracks and returns a score indicating match quality
 func Match(a, b model.LovedTrack) Score {
-	// Best match: track MBID
-	if a.TrackMBID != "" && b.TrackMBID != "" && a.TrackMBID == b.TrackMBID {
-		return TrackMBID
+	return Explain(a, b).Score
+}
+
+// Explain compares two LovedTracks and describes the resulting score, using
+// the default rules
+func Explain(a, b model.LovedTrack) Explanation {
+	return DefaultRules.Explain(a, b)
+}
+
+// explainPrimaryArtists compares the tracks using only their primary artists,
+// updating the compared keys if they are close enough to match.
+func (e *Explanation) explainPrimaryArtists(a, b model.LovedTrack) bool {
+	aPrimary, bPrimary := e.names.primaryArtists(a, b)
+	if aPrimary == "" || bPrimary == "" {
+		return false
 	}
 
-	// Album + Artist MBID match
-	if a.AlbumMBID != "" && b.AlbumMBID != "" && a.AlbumMBID == b.AlbumMBID &&
-		a.ArtistMBID != "" && b.ArtistMBID != "" && a.ArtistMBID == b.ArtistMBID {
-		return AlbumArtistMBID
+	aKey := e.names.forMatching(aPrimary) + "|" + e.names.title(a.Track)
+	bKey := e.names.forMatching(bPrimary) + "|" + e.names.title(b.Track)
+	if aKey == e.KeyA && bKey == e.KeyB {
+		return false
 	}
 
-	// Artist MBID + track name match
-	if a.ArtistMBID != "" && b.ArtistMBID != "" && a.ArtistMBID == b.ArtistMBID &&
-		a.Track != "" && b.Track != "" && strings.EqualFold(a.Track, b.Track) {
-		return ArtistMBID
+	distance := levenshtein.ComputeDistance(aKey, bKey)
+	if distance > maxLevenshteinDistance {
+		return false
 	}
 
-	// Exact artist and track name match
-	if a.Artist != "" && b.Artist != "" && a.Track != "" && b.Track != "" &&
-		strings.EqualFold(a.Artist, b.Artist) && strings.EqualFold(a.Track, b.Track) {
-		return ExactMatch
+	e.KeyA, e.KeyB, e.Distance = aKey, bKey, distance
+	return true
+}
+
+// durationDifference returns the absolute difference in the tracks' lengths, or -1 if either is unknown
+func durationDifference(a, b model.LovedTrack) time.Duration {
+	if a.Duration <= 0 || b.Duration <= 0 {
+		return -1
 	}
 
-	// Fuzzy match on artist + track name
-	if a.Artist != "" && b.Artist != "" && a.Track != "" && b.Track != "" {
-		aKey := normalizeForMatching(a.Artist) + "|" + normalizeForMatching(a.Track)
-		bKey := normalizeForMatching(b.Artist) + "|" + normalizeForMatching(b.Track)
-		distance := levenshtein.ComputeDistance(aKey, bKey)
-		if distance <= maxLevenshteinDistance {
-			return FuzzyMatch
+	if a.Duration > b.Duration {
+		return a.Duration - b.Duration
+	}
+	return b.Duration - a.Duration
+}
+
+// durationsConflict determines whether the tracks' lengths are too far apart
+// for them to be the same recording
+func (e *Explanation) durationsConflict(a, b model.LovedTrack) bool {
+	if e.DurationDifference <= maxDurationDifference {
+		return false
+	}
+
+	longest := max(a.Duration, b.Duration)
+	return float64(e.DurationDifference) > float64(longest)*maxDurationDifferenceRatio
+}
+
+// better determines whether explanation a describes a better match than b.
+// Equal scores are split by confidence, then closeness of durations and names.
+func better(a, b Explanation) bool {
+	if a.Score != b.Score {
+		return a.Score > b.Score
+	}
+
+	if a.Confidence != b.Confidence {
+		return a.Confidence > b.Confidence
+	}
+
+	if a.DurationDifference != b.DurationDifference {
+		if a.DurationDifference == -1 || b.DurationDifference == -1 {
+			return b.DurationDifference == -1
 		}
+		return a.DurationDifference < b.DurationDifference
 	}
 
-	return NoMatch
+	if a.Distance != b.Distance {
+		if a.Distance == -1 || b.Distance == -1 {
+			return b.Distance == -1
+		}
+		return a.Distance < b.Distance
+	}
+
+	return false
 }
 
-func normalizeForMatching(s string) string {
-	s = strings.ToLower(s)
+// shareISRC determines whether the tracks have any ISRCs in common
+func shareISRC(a, b model.LovedTrack) bool {
+	for _, aISRC := range a.ISRCs {
+		for _, bISRC := range b.ISRCs {
+			if normalizeISRC(aISRC) != "" && normalizeISRC(aISRC) == normalizeISRC(bISRC) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// normalizeISRC removes the optional separators from an ISRC, e.g. "US-RC1-76-07839"
+func normalizeISRC(isrc string) string {
+	return strings.ToUpper(strings.NewReplacer("-", "", " ", "").Replace(isrc))
+}
+
+// shareArtistMBID determines whether the tracks have any main artist MBIDs in common
+func shareArtistMBID(a, b model.LovedTrack) bool {
+	for _, aMBID := range a.MainArtistMBIDs() {
+		for _, bMBID := range b.MainArtistMBIDs() {
+			if aMBID == bMBID {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// editionSuffix matches qualifiers that distinguish editions of the same
+// album, such as "- Deluxe Edition" or "2011 Remaster"
+var editionSuffix = regexp.MustCompile(`\s*[-:]?\s*(\d{4}\s+)?(\d+(st|nd|rd|th)\s+anniversary|super deluxe|deluxe|expanded|special|limited|collector's|legacy|bonus tracks?|remastered|remaster)(\s+(edition|version))?$`)
 
-	// Remove anything in parentheses
+// normalizeAlbum normalises an album title for comparison, ignoring any
+// edition qualifiers
+func normalizeAlbum(s string) string {
+	s = normalizeForMatching(s)
 	for {
-		start := strings.Index(s, "(")
-		if start == -1 {
-			break
+		trimmed := strings.TrimSpace(editionSuffix.ReplaceAllString(s, ""))
+		if trimmed == s || trimmed == "" {
+			return s
 		}
-		end := strings.Index(s[start:], ")")
-		if end == -1 {
-			break
+		s = trimmed
+	}
+}
+
+// names caches normalised names, so that each name is only normalised once
+// while many tracks are being compared. A nil names normalises every time.
+type names struct {
+	matching map[string]string
+	titles   map[string]string
+	albums   map[string]string
+	credits  map[string][]model.ArtistCredit
+}
+
+// forMatching returns the name normalised by normalizeForMatching
+func (n *names) forMatching(s string) string {
+	if n == nil {
+		return normalizeForMatching(s)
+	}
+	return cached(&n.matching, s, normalizeForMatching)
+}
+
+// title returns the track title normalised by normalizeTitle
+func (n *names) title(s string) string {
+	if n == nil {
+		return normalizeTitle(s)
+	}
+	return cached(&n.titles, s, normalizeTitle)
+}
+
+// album returns the album title normalised by normalizeAlbum
+func (n *names) album(s string) string {
+	if n == nil {
+		return normalizeAlbum(s)
+	}
+	return cached(&n.albums, s, normalizeAlbum)
+}
+
+// primaryArtists returns the names of the tracks' primary artists, for
+// comparing tracks whose services credit several artists differently. Band
+// names such as "Simon & Garfunkel" look like several artists, so a name is
+// only split up if the service gave separate credits, or if both tracks seem
+// to credit several main artists. Otherwise the whole name is used.
+func (n *names) primaryArtists(a, b model.LovedTrack) (string, string) {
+	aCredits, bCredits := n.artistCredits(a), n.artistCredits(b)
+	split := mainArtists(aCredits) > 1 && mainArtists(bCredits) > 1
+	return primaryArtist(a, aCredits, split), primaryArtist(b, bCredits, split)
+}
+
+// artistCredits returns the track's structured artist credits, or those
+// parsed from its artist name if it doesn't have any
+func (n *names) artistCredits(track model.LovedTrack) []model.ArtistCredit {
+	if len(track.Artists) > 0 {
+		return track.Artists
+	}
+
+	if n == nil {
+		return model.ParseArtistCredits(track.Artist)
+	}
+
+	if credits, ok := n.credits[track.Artist]; ok {
+		return credits
+	}
+
+	if n.credits == nil {
+		n.credits = make(map[string][]model.ArtistCredit)
+	}
+	credits := model.ParseArtistCredits(track.Artist)
+	n.credits[track.Artist] = credits
+	return credits
+}
+
+// primaryArtist returns the name of the first main artist in the credits, or
+// the track's whole artist name if its credits were parsed and shouldn't be
+// split
+func primaryArtist(track model.LovedTrack, credits []model.ArtistCredit, split bool) string {
+	if len(track.Artists) == 0 && !split {
+		return track.Artist
+	}
+
+	for _, credit := range credits {
+		if !credit.Featured {
+			return credit.Name
 		}
-		s = s[:start] + s[start+end+1:]
 	}
+	return ""
+}
+
+// mainArtists counts the credits that aren't for featured artists
+func mainArtists(credits []model.ArtistCredit) int {
+	count := 0
+	for _, credit := range credits {
+		if !credit.Featured {
+			count++
+		}
+	}
+	return count
+}
+
+func cached(cache *map[string]string, s string, normalize func(string) string) string {
+	if normalized, ok := (*cache)[s]; ok {
+		return normalized
+	}
+
+	if *cache == nil {
+		*cache = make(map[string]string)
+	}
+	normalized := normalize(s)
+	(*cache)[s] = normalized
+	return normalized
+}
+
+var (
+	// fileExtension matches audio file extensions left over from tagging tracks by filename
+	fileExtension = regexp.MustCompile(`\.(mp3|flac|m4a|ogg|oga|opus|wav|aac|wma|aiff?|ape|wv)$`)
+	// trackNumberPrefix matches leading track numbers like "03 - " or "3. "
+	trackNumberPrefix = regexp.MustCompile(`^\d{1,3}(\s+-\s+|\.\s+|_)`)
+	// qualifierSuffix matches dash-separated qualifiers that describe a version of the same recording, like
+	// " - 2011 Remaster", " - Radio Edit" or " - Live at Wembley"
+	qualifierSuffix = regexp.MustCompile(`\s+[-–]\s+((\d{4}\s+)?(digital\s+)?(remaster|remastered)(\s+\d{4})?(\s+version)?|live(\s+(at|in|from|on)\s+[^-–]+|\s+version)?|(radio|single|album|original|clean|explicit)\s+(edit|version|mix)|(mono|stereo)(\s+(version|mix))?|(demo|acoustic|instrumental)(\s+version)?|bonus\s+track|explicit)$`)
+)
+
+// normalizeTitle normalises a track title for comparison, also removing the
+// noise left in titles by tagging files by their names, and qualifiers after
+// a dash that describe a version of the same recording
+func normalizeTitle(s string) string {
+	s = strings.ToLower(strings.TrimSpace(s))
+
+	// Remove noise from libraries tagged using filenames
+	s = fileExtension.ReplaceAllString(s, "")
+	s = trackNumberPrefix.ReplaceAllString(s, "")
+
+	s = normalizeForMatching(s)
+
+	// Remove qualifiers after a dash
+	for {
+		trimmed := qualifierSuffix.ReplaceAllString(s, "")
+		if trimmed == s {
+			return s
+		}
+		s = trimmed
+	}
+}
+
+func normalizeForMatching(s string) string {
+	s = strings.ToLower(strings.TrimSpace(s))
+	s = transliterate(s)
+
+	// Remove anything in parentheses or square brackets
+	s = removeBracketed(s, "(", ")")
+	s = removeBracketed(s, "[", "]")
 
 	// Remove anything after feat/ft/featuring
 	for _, sep := range []string{" feat.", " feat ", " ft.", " ft ", " featuring "} {
@@ -91,3 +384,18 @@ func normalizeForMatching(s string) string {
 
 	return s
 }
+
+// removeBracketed removes any text between the given brackets, including the brackets
+func removeBracketed(s, open, close string) string {
+	for {
+		start := strings.Index(s, open)
+		if start == -1 {
+			return s
+		}
+		end := strings.Index(s[start:], close)
+		if end == -1 {
+			return s
+		}
+		s = s[:start] + s[start+end+1:]
+	}
+}
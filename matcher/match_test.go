@@ -2,9 +2,11 @@ package matcher
 
 import (
 	"testing"
+	"time"
 
 	"github.com/csmith/musiclover/model"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func TestNormalizeForMatching(t *testing.T) {
@@ -48,6 +50,11 @@ func TestNormalizeForMatching(t *testing.T) {
 			input:    "Song   With    Spaces",
 			expected: "song with spaces",
 		},
+		{
+			name:     "remove square brackets",
+			input:    "Song [Remastered]",
+			expected: "song",
+		},
 		{
 			name:     "complex example",
 			input:    "The Song (Live) feat. Artist",
@@ -63,6 +70,93 @@ func TestNormalizeForMatching(t *testing.T) {
 	}
 }
 
+func TestNormalizeTitle(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		expected string
+	}{
+		{
+			name:     "remove dash remaster suffix",
+			input:    "Song - 2011 Remaster",
+			expected: "song",
+		},
+		{
+			name:     "remove dash live suffix",
+			input:    "Song - Live at Wembley",
+			expected: "song",
+		},
+		{
+			name:     "remove multiple dash suffixes",
+			input:    "Song - Radio Edit - Remastered",
+			expected: "song",
+		},
+		{
+			name:     "keep dash without qualifier",
+			input:    "Song - Part Two",
+			expected: "song - part two",
+		},
+		{
+			name:     "remove track number prefix",
+			input:    "03 - Song",
+			expected: "song",
+		},
+		{
+			name:     "remove dotted track number prefix",
+			input:    "3. Song",
+			expected: "song",
+		},
+		{
+			name:     "keep leading number in title",
+			input:    "99 Problems",
+			expected: "99 problems",
+		},
+		{
+			name:     "remove file extension",
+			input:    "03 - Song.mp3",
+			expected: "song",
+		},
+		{
+			name:     "remove dash radio edit suffix",
+			input:    "Song - Radio Edit",
+			expected: "song",
+		},
+		{
+			name:     "keep dash remix suffix",
+			input:    "Song - Extended Mix",
+			expected: "song - extended mix",
+		},
+		{
+			name:     "keep dash suffix only containing a qualifier word",
+			input:    "Song - The Version of Me",
+			expected: "song - the version of me",
+		},
+		{
+			name:     "normalise like other names",
+			input:    "The Song (Live) feat. Artist",
+			expected: "song",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.expected, normalizeTitle(tt.input))
+		})
+	}
+}
+
+func TestNormalizeForMatching_KeepsTitleNoise(t *testing.T) {
+	assert.Equal(t, "10 - years", normalizeForMatching("10 - Years"))
+	assert.Equal(t, "artist - live", normalizeForMatching("Artist - Live"))
+	assert.Equal(t, "mix - tape.mp3", normalizeForMatching("Mix - Tape.mp3"))
+}
+
+func TestMatch_FilenameTags(t *testing.T) {
+	subsonic := model.LovedTrack{Artist: "Artist", Track: "07 - Song [2011 Remaster].flac"}
+	lastfm := model.LovedTrack{Artist: "Artist", Track: "Song - 2011 Remaster"}
+	assert.Equal(t, FuzzyMatch, Match(subsonic, lastfm))
+}
+
 func TestMatch(t *testing.T) {
 	tests := []struct {
 		name     string
@@ -84,6 +178,68 @@ func TestMatch(t *testing.T) {
 			},
 			expected: TrackMBID,
 		},
+		{
+			name: "ISRC match",
+			trackA: model.LovedTrack{
+				Track:  "Song",
+				Artist: "Artist",
+				ISRCs:  []string{"USRC17607839"},
+			},
+			trackB: model.LovedTrack{
+				Track:  "Song (2011 Remaster)",
+				Artist: "The Artist",
+				ISRCs:  []string{"USRC17607839"},
+			},
+			expected: ISRC,
+		},
+		{
+			name: "ISRC match with multiple ISRCs per recording",
+			trackA: model.LovedTrack{
+				ISRCs: []string{"GBAYE0601498", "USRC17607839"},
+			},
+			trackB: model.LovedTrack{
+				ISRCs: []string{"DEUM71100123", "USRC17607839", "FRZ039800212"},
+			},
+			expected: ISRC,
+		},
+		{
+			name: "ISRC match ignores separators and case",
+			trackA: model.LovedTrack{
+				ISRCs: []string{"US-RC1-76-07839"},
+			},
+			trackB: model.LovedTrack{
+				ISRCs: []string{"usrc17607839"},
+			},
+			expected: ISRC,
+		},
+		{
+			name: "ISRC takes precedence over album and artist MBIDs",
+			trackA: model.LovedTrack{
+				AlbumMBID:  "album-mbid-123",
+				ArtistMBID: "artist-mbid-123",
+				ISRCs:      []string{"GBAYE0601498", "USRC17607839"},
+			},
+			trackB: model.LovedTrack{
+				AlbumMBID:  "album-mbid-123",
+				ArtistMBID: "artist-mbid-123",
+				ISRCs:      []string{"USRC17607839"},
+			},
+			expected: ISRC,
+		},
+		{
+			name: "no match - different ISRCs and names",
+			trackA: model.LovedTrack{
+				Track:  "Song One",
+				Artist: "Artist",
+				ISRCs:  []string{"GBAYE0601498", "GBAYE0601499"},
+			},
+			trackB: model.LovedTrack{
+				Track:  "Completely Different Song",
+				Artist: "Artist",
+				ISRCs:  []string{"USRC17607839"},
+			},
+			expected: NoMatch,
+		},
 		{
 			name: "album and artist MBID match",
 			trackA: model.LovedTrack{
@@ -200,6 +356,141 @@ func TestMatch(t *testing.T) {
 			},
 			expected: NoMatch,
 		},
+		{
+			name: "primary artist match with multiple artists",
+			trackA: model.LovedTrack{
+				Track:  "Song Name",
+				Artist: "Artist A & Artist B",
+			},
+			trackB: model.LovedTrack{
+				Track:  "Song Name",
+				Artist: "Artist A, Artist C",
+			},
+			expected: FuzzyMatch,
+		},
+		{
+			name: "band names aren't split up",
+			trackA: model.LovedTrack{
+				Track:  "Song Name",
+				Artist: "Simon & Garfunkel",
+			},
+			trackB: model.LovedTrack{
+				Track:  "Song Name",
+				Artist: "Simon",
+			},
+			expected: NoMatch,
+		},
+		{
+			name: "band names with commas aren't split up",
+			trackA: model.LovedTrack{
+				Track:  "Song Name",
+				Artist: "Earth, Wind & Fire",
+			},
+			trackB: model.LovedTrack{
+				Track:  "Song Name",
+				Artist: "Earth",
+			},
+			expected: NoMatch,
+		},
+		{
+			name: "primary artist match with structured credits",
+			trackA: model.LovedTrack{
+				Track:  "Song Name",
+				Artist: "Artist A x Artist B",
+				Artists: []model.ArtistCredit{
+					{Name: "Artist A"},
+					{Name: "Artist B"},
+				},
+			},
+			trackB: model.LovedTrack{
+				Track:  "Song Name",
+				Artist: "Artist A, Artist B and Artist C",
+			},
+			expected: FuzzyMatch,
+		},
+		{
+			name: "no match on featured artist only",
+			trackA: model.LovedTrack{
+				Track:  "Song Name",
+				Artist: "Singer feat. Rapper",
+			},
+			trackB: model.LovedTrack{
+				Track:  "Song Name",
+				Artist: "Rapper",
+			},
+			expected: NoMatch,
+		},
+		{
+			name: "artist MBID from structured credits",
+			trackA: model.LovedTrack{
+				Track:  "Song Name",
+				Artist: "Artist A & Artist B",
+				Artists: []model.ArtistCredit{
+					{Name: "Artist A", MBID: "artist-mbid-a"},
+					{Name: "Artist B", MBID: "artist-mbid-b"},
+				},
+			},
+			trackB: model.LovedTrack{
+				Track:      "Song Name",
+				Artist:     "B",
+				ArtistMBID: "artist-mbid-b",
+			},
+			expected: ArtistMBID,
+		},
+		{
+			name: "exact match with similar durations",
+			trackA: model.LovedTrack{
+				Track:    "Intro",
+				Artist:   "Artist",
+				Duration: 4*time.Minute + 10*time.Second,
+			},
+			trackB: model.LovedTrack{
+				Track:    "Intro",
+				Artist:   "Artist",
+				Duration: 4*time.Minute + 30*time.Second,
+			},
+			expected: ExactMatch,
+		},
+		{
+			name: "no match - exact names with very different durations",
+			trackA: model.LovedTrack{
+				Track:    "Intro",
+				Artist:   "Artist",
+				Duration: 1 * time.Minute,
+			},
+			trackB: model.LovedTrack{
+				Track:    "Intro",
+				Artist:   "Artist",
+				Duration: 3 * time.Minute,
+			},
+			expected: NoMatch,
+		},
+		{
+			name: "no match - fuzzy names with very different durations",
+			trackA: model.LovedTrack{
+				Track:    "Song",
+				Artist:   "Artist",
+				Duration: 4 * time.Minute,
+			},
+			trackB: model.LovedTrack{
+				Track:    "Song (Extended Mix)",
+				Artist:   "Artist",
+				Duration: 9 * time.Minute,
+			},
+			expected: NoMatch,
+		},
+		{
+			name: "track MBID ignores durations",
+			trackA: model.LovedTrack{
+				TrackMBID: "mbid-123",
+				Duration:  1 * time.Minute,
+			},
+			trackB: model.LovedTrack{
+				TrackMBID: "mbid-123",
+				Duration:  5 * time.Minute,
+			},
+			expected: TrackMBID,
+		},
 		{
 			name: "track MBID takes precedence over exact match",
 			trackA: model.LovedTrack{
@@ -223,3 +514,85 @@ func TestMatch(t *testing.T) {
 		})
 	}
 }
+
+func TestExplain(t *testing.T) {
+	e := Explain(
+		model.LovedTrack{Artist: "The Artist", Track: "Song Name (Remastered)"},
+		model.LovedTrack{Artist: "Artist", Track: "Song Naem"},
+	)
+
+	assert.Equal(t, FuzzyMatch, e.Score)
+	assert.Equal(t, "artist|song name", e.KeyA)
+	assert.Equal(t, "artist|song naem", e.KeyB)
+	assert.Equal(t, 2, e.Distance)
+	assert.NotEmpty(t, e.Rule)
+}
+
+func TestNormalizeAlbum(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"Mezzanine", "mezzanine"},
+		{"Mezzanine (Deluxe Edition)", "mezzanine"},
+		{"Mezzanine - Deluxe Edition", "mezzanine"},
+		{"Mezzanine: 2019 Remaster", "mezzanine"},
+		{"OK Computer - 20th Anniversary Edition", "ok computer"},
+		{"Nevermind Super Deluxe Edition", "nevermind"},
+		{"Remastered", "remastered"},
+		{"Special", "special"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			assert.Equal(t, tt.expected, normalizeAlbum(tt.input))
+		})
+	}
+}
+
+func TestExplain_Albums(t *testing.T) {
+	target := model.LovedTrack{Artist: "Artist", Track: "Song", Album: "Album"}
+
+	same := Explain(target, model.LovedTrack{Artist: "Artist", Track: "Song", Album: "Album (Deluxe Edition)"})
+	different := Explain(target, model.LovedTrack{Artist: "Artist", Track: "Song", Album: "Other Record"})
+	unknown := Explain(target, model.LovedTrack{Artist: "Artist", Track: "Song"})
+
+	assert.Contains(t, same.Rule, "same album")
+	assert.Contains(t, different.Rule, "different album")
+	assert.Greater(t, same.Confidence, unknown.Confidence)
+	assert.Greater(t, unknown.Confidence, different.Confidence)
+
+	tracks := []model.LovedTrack{
+		{ID: "1", Artist: "Artist", Track: "Song", Album: "Other Record"},
+		{ID: "2", Artist: "Artist", Track: "Song", Album: "Album - 2011 Remaster"},
+	}
+	assert.Equal(t, 1, Find(tracks, target, WithTieBreakers()))
+}
+
+func TestExplain_WithoutNames(t *testing.T) {
+	e := Explain(
+		model.LovedTrack{TrackMBID: "mbid-1"},
+		model.LovedTrack{TrackMBID: "mbid-1", Artist: "Artist", Track: "Song"},
+	)
+
+	assert.Equal(t, TrackMBID, e.Score)
+	assert.Equal(t, -1, e.Distance)
+}
+
+func TestScore_String(t *testing.T) {
+	assert.Equal(t, "TrackMBID", TrackMBID.String())
+	assert.Equal(t, "Score(42)", Score(42).String())
+}
+
+func TestParseScore(t *testing.T) {
+	score, err := ParseScore("isrc")
+	require.NoError(t, err)
+	assert.Equal(t, ISRC, score)
+
+	score, err = ParseScore("TrackMBID")
+	require.NoError(t, err)
+	assert.Equal(t, TrackMBID, score)
+
+	_, err = ParseScore("perfect")
+	assert.Error(t, err)
+}
@@ -0,0 +1,130 @@
+package matcher
+
+import (
+	"fmt"
+
+	"github.com/csmith/musiclover/model"
+)
+
+// Option configures optional behaviour of Segment and Find
+type Option func(*config)
+
+type config struct {
+	overrides     *Overrides
+	minConfidence float64
+	pairings      *Pairings
+	namespace     string
+	tieBreakers   []TieBreaker
+	matcher       Matcher
+	aliases       *Aliases
+	duplicates    Score
+
+	// names caches normalised names for the duration of a single call, such
+	// as a Segment, so each track's names are only normalised once
+	names *names
+}
+
+// WithOverrides applies the given user overrides before scoring tracks
+func WithOverrides(overrides *Overrides) Option {
+	return func(c *config) {
+		c.overrides = overrides
+	}
+}
+
+// WithMinConfidence rejects matches that aren't based on a recording MBID or
+// ISRC if their confidence is below the given value (between 0 and 1)
+func WithMinConfidence(confidence float64) Option {
+	return func(c *config) {
+		c.minConfidence = confidence
+	}
+}
+
+// WithPairings consults the given pairings before scoring tracks. Search
+// records the track it chooses, while Segment's pairs have to be recorded by
+// the caller with Pairings.Replace. The namespace should identify the two
+// sets of tracks being compared, such as a source and destination.
+func WithPairings(pairings *Pairings, namespace string) Option {
+	return func(c *config) {
+		c.pairings = pairings
+		c.namespace = namespace
+	}
+}
+
+// WithTieBreakers sets the preferences used to choose between candidates that
+// match equally well, in order of priority. By default, DefaultTieBreakers
+// are used.
+func WithTieBreakers(tieBreakers ...TieBreaker) Option {
+	return func(c *config) {
+		c.tieBreakers = tieBreakers
+	}
+}
+
+// WithMatcher compares tracks using the given matcher, such as a Pipeline of
+// rules, instead of the default rules. Overrides are only applied to scores if
+// the matcher includes them; ignored tracks are always skipped.
+func WithMatcher(matcher Matcher) Option {
+	return func(c *config) {
+		c.matcher = matcher
+	}
+}
+
+// WithAliases treats artist names as equal if they're known aliases of the
+// same artist
+func WithAliases(aliases *Aliases) Option {
+	return func(c *config) {
+		c.aliases = aliases
+	}
+}
+
+// WithDuplicates treats tracks that match each other at or above the given
+// score as copies of the same recording, such as the same song on an album
+// and a deluxe edition. Copies are interchangeable: a search that finds
+// several equally good copies picks one rather than being ambiguous, and
+// Segment counts extra copies of a paired track as matched.
+func WithDuplicates(score Score) Option {
+	return func(c *config) {
+		c.duplicates = score
+	}
+}
+
+// copies determines whether two tracks matched with the given score are
+// copies of the same recording
+func (c *config) copies(score Score) bool {
+	return c.duplicates != NoMatch && score >= c.duplicates
+}
+
+func configFor(opts []Option) *config {
+	c := &config{tieBreakers: DefaultTieBreakers, names: &names{}}
+	for i := range opts {
+		opts[i](c)
+	}
+
+	if c.matcher == nil {
+		c.matcher = append(Pipeline{c.overrides}, DefaultRules...)
+	}
+	return c
+}
+
+// explain describes how a source track and destination track are scored,
+// taking artist aliases into account and rejecting matches that aren't
+// confident enough
+func (c *config) explain(source, destination model.LovedTrack) Explanation {
+	destination, aliased := c.aliases.unify(source, destination, c.names)
+
+	var e Explanation
+	if pipeline, ok := c.matcher.(Pipeline); ok {
+		e = pipeline.explain(source, destination, c.names)
+	} else {
+		e = c.matcher.Explain(source, destination)
+	}
+	if aliased && e.Score != NoMatch && e.Score < ISRC {
+		e.Rule += ", via artist alias"
+	}
+
+	if e.Score != NoMatch && e.Score < ISRC && e.Confidence < c.minConfidence {
+		e.Rule = fmt.Sprintf("%s, but confidence %s is below %s", e.Rule, FormatConfidence(e.Confidence), FormatConfidence(c.minConfidence))
+		e.Rejection = fmt.Sprintf("%s below confidence threshold", e.Score)
+		e.Score = NoMatch
+	}
+	return e
+}
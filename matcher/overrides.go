@@ -0,0 +1,183 @@
+package matcher
+
+import (
+	"fmt"
+	"os"
+	"sync"
+
+	"github.com/csmith/musiclover/model"
+	"gopkg.in/yaml.v3"
+)
+
+// Selector identifies a track by one or more of its identifiers. All non-empty
+// fields must match for a track to be selected; an empty selector matches nothing.
+type Selector struct {
+	MBID   string `yaml:"mbid"`
+	ID     string `yaml:"id"`
+	Artist string `yaml:"artist"`
+	Title  string `yaml:"title"`
+}
+
+// Pin forces a source track to match a specific destination track
+type Pin struct {
+	Source      Selector `yaml:"source"`
+	Destination Selector `yaml:"destination"`
+}
+
+// Never prevents two tracks from ever being matched with each other
+type Never struct {
+	A Selector `yaml:"a"`
+	B Selector `yaml:"b"`
+}
+
+// OverrideRules is the content of an overrides file
+type OverrideRules struct {
+	Pins   []Pin      `yaml:"pin"`
+	Never  []Never    `yaml:"never"`
+	Ignore []Selector `yaml:"ignore"`
+}
+
+// Overrides holds user-supplied corrections to the matcher. It is safe to
+// reload while in use, and a nil Overrides applies no corrections.
+type Overrides struct {
+	mu    sync.RWMutex
+	rules OverrideRules
+}
+
+// Load replaces the current rules with those read from the given YAML or JSON file
+func (o *Overrides) Load(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("failed to read overrides: %w", err)
+	}
+
+	var rules OverrideRules
+	if err := yaml.Unmarshal(data, &rules); err != nil {
+		return fmt.Errorf("failed to parse overrides: %w", err)
+	}
+
+	o.Set(rules)
+	return nil
+}
+
+// Set replaces the current rules with the given ones
+func (o *Overrides) Set(rules OverrideRules) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.rules = rules
+}
+
+// Ignored determines whether the track should be left out of matching entirely
+func (o *Overrides) Ignored(track model.LovedTrack) bool {
+	return o.ignored(track, nil)
+}
+
+func (o *Overrides) ignored(track model.LovedTrack, n *names) bool {
+	if o == nil {
+		return false
+	}
+
+	o.mu.RLock()
+	defer o.mu.RUnlock()
+
+	for i := range o.rules.Ignore {
+		if o.rules.Ignore[i].matches(track, n) {
+			return true
+		}
+	}
+	return false
+}
+
+// Apply checks whether any rules affect the pairing of the source and
+// destination tracks. It returns the forced score, and true if a rule applied.
+// Rules apply the same way whichever side each track comes from.
+func (o *Overrides) Apply(source, destination model.LovedTrack) (Score, bool) {
+	return o.apply(source, destination, nil)
+}
+
+func (o *Overrides) apply(source, destination model.LovedTrack, n *names) (Score, bool) {
+	if o == nil {
+		return NoMatch, false
+	}
+
+	o.mu.RLock()
+	defer o.mu.RUnlock()
+
+	for _, never := range o.rules.Never {
+		if (never.A.matches(source, n) && never.B.matches(destination, n)) ||
+			(never.B.matches(source, n) && never.A.matches(destination, n)) {
+			return NoMatch, true
+		}
+	}
+
+	// Several tracks may be pinned to the same one, so every pin has to be
+	// checked before deciding the tracks aren't pinned together
+	for _, pin := range o.rules.Pins {
+		if (pin.Source.matches(source, n) && pin.Destination.matches(destination, n)) ||
+			(pin.Source.matches(destination, n) && pin.Destination.matches(source, n)) {
+			return Override, true
+		}
+	}
+
+	// A pinned track may not match anything other than its counterparts
+	for _, pin := range o.rules.Pins {
+		if pin.Source.matches(source, n) || pin.Destination.matches(destination, n) ||
+			pin.Source.matches(destination, n) || pin.Destination.matches(source, n) {
+			return NoMatch, true
+		}
+	}
+
+	return NoMatch, false
+}
+
+// Name returns the name of the overrides rule, allowing overrides to be used
+// in a Pipeline
+func (o *Overrides) Name() string {
+	return "overrides"
+}
+
+// Check applies the overrides as a rule in a Pipeline
+func (o *Overrides) Check(a, b model.LovedTrack, e *Explanation) bool {
+	score, ok := o.apply(a, b, e.names)
+	if !ok {
+		return false
+	}
+
+	e.Score = score
+	if score == Override {
+		e.Rule = "pinned together by overrides"
+	} else {
+		e.Rule = "kept apart by overrides"
+		e.Rejection = "kept apart by overrides"
+	}
+	return true
+}
+
+// Matches determines whether the selector applies to the given track
+func (s Selector) Matches(track model.LovedTrack) bool {
+	return s.matches(track, nil)
+}
+
+func (s Selector) matches(track model.LovedTrack, n *names) bool {
+	if s.MBID == "" && s.ID == "" && s.Artist == "" && s.Title == "" {
+		return false
+	}
+
+	if s.MBID != "" && s.MBID != track.TrackMBID {
+		return false
+	}
+
+	if s.ID != "" && s.ID != track.ID {
+		return false
+	}
+
+	if s.Artist != "" && n.forMatching(s.Artist) != n.forMatching(track.Artist) {
+		return false
+	}
+
+	if s.Title != "" && n.title(s.Title) != n.title(track.Track) {
+		return false
+	}
+
+	return true
+}
@@ -0,0 +1,186 @@
+package matcher
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/csmith/musiclover/model"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestOverrides_Load(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "overrides.yml")
+	require.NoError(t, os.WriteFile(path, []byte(`
+pin:
+  - source: {artist: "Artist", title: "Song"}
+    destination: {id: "song-2"}
+never:
+  - a: {mbid: "mbid-1"}
+    b: {mbid: "mbid-2"}
+ignore:
+  - artist: "Ignored Artist"
+`), 0600))
+
+	o := &Overrides{}
+	require.NoError(t, o.Load(path))
+
+	assert.Len(t, o.rules.Pins, 1)
+	assert.Equal(t, "song-2", o.rules.Pins[0].Destination.ID)
+	assert.Len(t, o.rules.Never, 1)
+	assert.Len(t, o.rules.Ignore, 1)
+}
+
+func TestOverrides_LoadJSON(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "overrides.json")
+	require.NoError(t, os.WriteFile(path, []byte(`{"ignore": [{"mbid": "mbid-1"}]}`), 0600))
+
+	o := &Overrides{}
+	require.NoError(t, o.Load(path))
+	assert.True(t, o.Ignored(model.LovedTrack{TrackMBID: "mbid-1"}))
+}
+
+func TestOverrides_Apply(t *testing.T) {
+	o := &Overrides{}
+	o.Set(OverrideRules{
+		Pins: []Pin{
+			{Source: Selector{Artist: "Artist", Title: "Song"}, Destination: Selector{ID: "song-2"}},
+			{Source: Selector{Artist: "Cover Band", Title: "Song"}, Destination: Selector{ID: "song-2"}},
+		},
+		Never: []Never{
+			{A: Selector{MBID: "mbid-1"}, B: Selector{ID: "song-3"}},
+		},
+	})
+
+	tests := []struct {
+		name        string
+		source      model.LovedTrack
+		destination model.LovedTrack
+		expected    Score
+		applied     bool
+	}{
+		{
+			name:        "pinned pair",
+			source:      model.LovedTrack{Artist: "The Artist", Track: "Song (Live)"},
+			destination: model.LovedTrack{ID: "song-2", Artist: "Other", Track: "Other"},
+			expected:    Override,
+			applied:     true,
+		},
+		{
+			name:        "second track pinned to the same destination",
+			source:      model.LovedTrack{Artist: "Cover Band", Track: "Song"},
+			destination: model.LovedTrack{ID: "song-2"},
+			expected:    Override,
+			applied:     true,
+		},
+		{
+			name:        "pinned pair reversed",
+			source:      model.LovedTrack{ID: "song-2"},
+			destination: model.LovedTrack{Artist: "Cover Band", Track: "Song"},
+			expected:    Override,
+			applied:     true,
+		},
+		{
+			name:        "pinned source against other track",
+			source:      model.LovedTrack{Artist: "Artist", Track: "Song"},
+			destination: model.LovedTrack{ID: "song-1", Artist: "Artist", Track: "Song"},
+			expected:    NoMatch,
+			applied:     true,
+		},
+		{
+			name:        "pinned destination against other track",
+			source:      model.LovedTrack{Artist: "Artist", Track: "Other Song"},
+			destination: model.LovedTrack{ID: "song-2", Artist: "Artist", Track: "Other Song"},
+			expected:    NoMatch,
+			applied:     true,
+		},
+		{
+			name:        "never match",
+			source:      model.LovedTrack{TrackMBID: "mbid-1"},
+			destination: model.LovedTrack{ID: "song-3", TrackMBID: "mbid-1"},
+			expected:    NoMatch,
+			applied:     true,
+		},
+		{
+			name:        "never match reversed",
+			source:      model.LovedTrack{ID: "song-3"},
+			destination: model.LovedTrack{TrackMBID: "mbid-1"},
+			expected:    NoMatch,
+			applied:     true,
+		},
+		{
+			name:        "unaffected",
+			source:      model.LovedTrack{Artist: "Artist", Track: "Another"},
+			destination: model.LovedTrack{ID: "song-4", Artist: "Artist", Track: "Another"},
+			expected:    NoMatch,
+			applied:     false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			score, applied := o.Apply(tt.source, tt.destination)
+			assert.Equal(t, tt.expected, score)
+			assert.Equal(t, tt.applied, applied)
+		})
+	}
+}
+
+func TestOverrides_Nil(t *testing.T) {
+	var o *Overrides
+	assert.False(t, o.Ignored(model.LovedTrack{Artist: "Artist", Track: "Song"}))
+
+	_, applied := o.Apply(model.LovedTrack{}, model.LovedTrack{})
+	assert.False(t, applied)
+}
+
+func TestSegment_WithOverrides(t *testing.T) {
+	o := &Overrides{}
+	o.Set(OverrideRules{
+		Pins: []Pin{
+			{Source: Selector{Artist: "Artist", Title: "Song"}, Destination: Selector{ID: "live"}},
+		},
+		Ignore: []Selector{
+			{Artist: "Podcast"},
+		},
+	})
+
+	desired := []model.LovedTrack{
+		{Artist: "Artist", Track: "Song"},
+		{Artist: "Podcast", Track: "Episode 1"},
+	}
+	actual := []model.LovedTrack{
+		{ID: "studio", Artist: "Artist", Track: "Song"},
+		{ID: "live", Artist: "Artist", Track: "Song (Live at Wembley)"},
+		{ID: "pod", Artist: "Podcast", Track: "Episode 2"},
+	}
+
+	result := Segment(desired, actual, WithOverrides(o))
+
+	assert.Equal(t, []model.LovedTrack{desired[0]}, result.Matched)
+	assert.Empty(t, result.Missing)
+	assert.Equal(t, []model.LovedTrack{actual[0]}, result.Extra)
+	assert.ElementsMatch(t, []model.LovedTrack{desired[1], actual[2]}, result.Ignored)
+}
+
+func TestFind_WithOverrides(t *testing.T) {
+	o := &Overrides{}
+	o.Set(OverrideRules{
+		Pins: []Pin{
+			{Source: Selector{MBID: "mbid-1"}, Destination: Selector{ID: "song-2"}},
+		},
+		Ignore: []Selector{
+			{Title: "Ignored"},
+		},
+	})
+
+	tracks := []model.LovedTrack{
+		{ID: "song-1", Artist: "Artist", Track: "Song", TrackMBID: "mbid-1"},
+		{ID: "song-2", Artist: "Artist", Track: "Song (Remastered)"},
+	}
+
+	assert.Equal(t, 1, Find(tracks, model.LovedTrack{Artist: "Artist", Track: "Song", TrackMBID: "mbid-1"}, WithOverrides(o)))
+	assert.Equal(t, 0, Find(tracks, model.LovedTrack{Artist: "Artist", Track: "Song", TrackMBID: "mbid-1"}))
+	assert.Equal(t, -1, Find(tracks, model.LovedTrack{Artist: "Artist", Track: "Ignored"}, WithOverrides(o)))
+}
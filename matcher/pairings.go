@@ -0,0 +1,176 @@
+package matcher
+
+import (
+	"sync"
+
+	"github.com/csmith/musiclover/model"
+	"github.com/csmith/musiclover/state"
+)
+
+const pairingsFile = "pairings.json"
+
+// Pairings remembers which tracks have been matched with each other, so that
+// later runs make the same choices without having to score every candidate.
+// Pairings are grouped into namespaces, e.g. one per source and destination,
+// and map the identity of a desired track to the identity of an actual one.
+type Pairings struct {
+	mu    sync.Mutex
+	pairs map[string]map[string]string
+	dirty bool
+}
+
+// Load reads previously saved pairings from the state directory
+func (p *Pairings) Load(dir string) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.pairs = make(map[string]map[string]string)
+	return state.Load(dir, pairingsFile, &p.pairs)
+}
+
+// Save writes the pairings to the state directory, if they've changed
+func (p *Pairings) Save(dir string) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if !p.dirty {
+		return nil
+	}
+
+	if err := state.Save(dir, pairingsFile, p.pairs); err != nil {
+		return err
+	}
+	p.dirty = false
+	return nil
+}
+
+// Lookup returns the identity of the track previously paired with the given one
+func (p *Pairings) Lookup(namespace, identity string) (string, bool) {
+	if p == nil {
+		return "", false
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	paired, ok := p.pairs[namespace][identity]
+	return paired, ok
+}
+
+// Record remembers that the two tracks were paired
+func (p *Pairings) Record(namespace, desired, actual string) {
+	if p == nil {
+		return
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.pairs == nil {
+		p.pairs = make(map[string]map[string]string)
+	}
+	if p.pairs[namespace] == nil {
+		p.pairs[namespace] = make(map[string]string)
+	}
+
+	if p.pairs[namespace][desired] != actual {
+		p.pairs[namespace][desired] = actual
+		p.dirty = true
+	}
+}
+
+// Forget removes any pairing for the given track
+func (p *Pairings) Forget(namespace, identity string) {
+	if p == nil {
+		return
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if _, ok := p.pairs[namespace][identity]; ok {
+		delete(p.pairs[namespace], identity)
+		p.dirty = true
+	}
+}
+
+// Replace discards all pairings in the namespace and replaces them with the
+// given pairs. Segment doesn't record its pairs itself, so this should be
+// called with them once they've been acted on.
+func (p *Pairings) Replace(namespace string, pairs []Pair) {
+	if p == nil {
+		return
+	}
+
+	replacement := make(map[string]string, len(pairs))
+	for _, pair := range pairs {
+		replacement[pair.Desired.Identity()] = pair.Actual.Identity()
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.pairs == nil {
+		p.pairs = make(map[string]map[string]string)
+	}
+
+	if !sameMapping(p.pairs[namespace], replacement) {
+		p.pairs[namespace] = replacement
+		p.dirty = true
+	}
+}
+
+// identityIndex maps the identity of each track to its positions in the slice
+type identityIndex map[string][]int
+
+func indexIdentities(tracks []model.LovedTrack) identityIndex {
+	index := make(identityIndex, len(tracks))
+	for i := range tracks {
+		identity := tracks[i].Identity()
+		index[identity] = append(index[identity], i)
+	}
+	return index
+}
+
+// lazyIdentities returns a function that indexes the tracks by identity the
+// first time it's called, as the index is only needed if there are pairings
+func lazyIdentities(tracks []model.LovedTrack) func() identityIndex {
+	return sync.OnceValue(func() identityIndex { return indexIdentities(tracks) })
+}
+
+// remembered finds the actual track that was previously paired with the
+// desired one, if it's still present and still matches
+func (c *config) remembered(desired model.LovedTrack, actual []model.LovedTrack, index func() identityIndex, available func(int) bool) (int, Explanation, bool) {
+	identity, ok := c.pairings.Lookup(c.namespace, desired.Identity())
+	if !ok {
+		return -1, Explanation{}, false
+	}
+
+	for _, i := range index()[identity] {
+		if !available(i) {
+			continue
+		}
+
+		e := c.explain(desired, actual[i])
+		if e.Score == NoMatch {
+			break
+		}
+
+		e.Rule += ", remembered from a previous run"
+		return i, e, true
+	}
+
+	return -1, Explanation{}, false
+}
+
+func sameMapping(a, b map[string]string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for k, v := range a {
+		if bv, ok := b[k]; !ok || bv != v {
+			return false
+		}
+	}
+	return true
+}
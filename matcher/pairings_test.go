@@ -0,0 +1,115 @@
+package matcher
+
+import (
+	"testing"
+
+	"github.com/csmith/musiclover/model"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSegment_WithPairings(t *testing.T) {
+	pairings := &Pairings{}
+	desired := []model.LovedTrack{
+		{Artist: "Artist", Track: "Song"},
+	}
+	album := model.LovedTrack{ID: "album", Artist: "Artist", Track: "Song"}
+	compilation := model.LovedTrack{ID: "compilation", Artist: "Artist", Track: "Song"}
+
+	// Segment doesn't record anything itself
+	result := Segment(desired, []model.LovedTrack{compilation, album}, WithPairings(pairings, "test"))
+	_, ok := pairings.Lookup("test", desired[0].Identity())
+	assert.False(t, ok)
+
+	// Both are equally good, so the first is chosen and remembered
+	assert.Equal(t, compilation, result.Pairs[0].Actual)
+	pairings.Replace("test", result.Pairs)
+
+	// The remembered pairing is preferred even when the order changes
+	result = Segment(desired, []model.LovedTrack{album, compilation}, WithPairings(pairings, "test"))
+	assert.Equal(t, compilation, result.Pairs[0].Actual)
+	assert.Contains(t, result.Pairs[0].Rule, "remembered")
+
+	// Other namespaces are unaffected
+	result = Segment(desired, []model.LovedTrack{album, compilation}, WithPairings(pairings, "other"))
+	assert.Equal(t, album, result.Pairs[0].Actual)
+
+	// If the remembered track disappears, the pairing is replaced
+	result = Segment(desired, []model.LovedTrack{album}, WithPairings(pairings, "test"))
+	assert.Equal(t, album, result.Pairs[0].Actual)
+	pairings.Replace("test", result.Pairs)
+	identity, ok := pairings.Lookup("test", desired[0].Identity())
+	assert.True(t, ok)
+	assert.Equal(t, "id:album", identity)
+
+	// If the desired track disappears, the pairing is forgotten
+	pairings.Replace("test", Segment(nil, []model.LovedTrack{album}, WithPairings(pairings, "test")).Pairs)
+	_, ok = pairings.Lookup("test", desired[0].Identity())
+	assert.False(t, ok)
+}
+
+func TestSegment_WithPairingsRespectsOverrides(t *testing.T) {
+	pairings := &Pairings{}
+	desired := []model.LovedTrack{{Artist: "Artist", Track: "Song"}}
+	actual := []model.LovedTrack{
+		{ID: "one", Artist: "Artist", Track: "Song"},
+		{ID: "two", Artist: "Artist", Track: "Song"},
+	}
+	pairings.Record("test", desired[0].Identity(), "id:one")
+
+	overrides := &Overrides{}
+	overrides.Set(OverrideRules{Never: []Never{{A: Selector{Title: "Song"}, B: Selector{ID: "one"}}}})
+
+	result := Segment(desired, actual, WithOverrides(overrides), WithPairings(pairings, "test"))
+	assert.Equal(t, actual[1], result.Pairs[0].Actual)
+}
+
+func TestFind_WithPairings(t *testing.T) {
+	pairings := &Pairings{}
+	target := model.LovedTrack{Artist: "Artist", Track: "Song"}
+	tracks := []model.LovedTrack{
+		{ID: "one", Artist: "Artist", Track: "Song"},
+		{ID: "two", Artist: "Artist", Track: "Song"},
+	}
+	pairings.Record("test", target.Identity(), "id:two")
+
+	assert.Equal(t, 1, Find(tracks, target, WithPairings(pairings, "test")))
+
+	// Stale pairings are forgotten and replaced
+	assert.Equal(t, 0, Find(tracks[:1], target, WithPairings(pairings, "test")))
+	identity, _ := pairings.Lookup("test", target.Identity())
+	assert.Equal(t, "id:one", identity)
+}
+
+func TestSearchEach_WithPairings(t *testing.T) {
+	pairings := &Pairings{}
+	targets := []model.LovedTrack{
+		{Artist: "Artist", Track: "Song"},
+		{Artist: "Artist", Track: "Other Song"},
+	}
+	tracks := []model.LovedTrack{
+		{ID: "one", Artist: "Artist", Track: "Song"},
+		{ID: "two", Artist: "Artist", Track: "Song"},
+		{ID: "three", Artist: "Artist", Track: "Other Song"},
+	}
+	pairings.Record("test", targets[0].Identity(), "id:two")
+
+	results := SearchEach(tracks, targets, WithPairings(pairings, "test"))
+	assert.Equal(t, 1, results[0].Index)
+	assert.Contains(t, results[0].Rule, "remembered")
+	assert.Equal(t, 2, results[1].Index)
+}
+
+func TestPairings_SaveLoad(t *testing.T) {
+	dir := t.TempDir()
+
+	pairings := &Pairings{}
+	pairings.Record("test", "name:artist|song", "id:123")
+	require.NoError(t, pairings.Save(dir))
+
+	loaded := &Pairings{}
+	require.NoError(t, loaded.Load(dir))
+	identity, ok := loaded.Lookup("test", "name:artist|song")
+	assert.True(t, ok)
+	assert.Equal(t, "id:123", identity)
+}
@@ -0,0 +1,37 @@
+package matcher
+
+import (
+	"sort"
+
+	"github.com/csmith/musiclover/model"
+)
+
+// Candidate is a potential match for a track, along with how it was scored
+type Candidate struct {
+	Index int
+	Explanation
+}
+
+// Rank scores every track in the slice against the target, and returns
+// them ordered from best to worst. Tracks ignored by overrides are omitted.
+func Rank(tracks []model.LovedTrack, target model.LovedTrack, opts ...Option) []Candidate {
+	c := configFor(opts)
+
+	candidates := make([]Candidate, 0, len(tracks))
+	for i := range tracks {
+		if c.overrides.ignored(tracks[i], c.names) {
+			continue
+		}
+
+		candidates = append(candidates, Candidate{
+			Index:       i,
+			Explanation: c.explain(target, tracks[i]),
+		})
+	}
+
+	sort.SliceStable(candidates, func(i, j int) bool {
+		return better(candidates[i].Explanation, candidates[j].Explanation)
+	})
+
+	return candidates
+}
@@ -0,0 +1,50 @@
+package matcher
+
+import (
+	"testing"
+
+	"github.com/csmith/musiclover/model"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRank(t *testing.T) {
+	tracks := []model.LovedTrack{
+		{Artist: "Other", Track: "Unrelated"},
+		{Artist: "Artist", Track: "Song Naem"},
+		{Artist: "Artist", Track: "Song Name"},
+		{TrackMBID: "mbid-2"},
+		{Artist: "Artist", Track: "Song Name (Live)"},
+	}
+
+	candidates := Rank(tracks, model.LovedTrack{Artist: "Artist", Track: "Song Name"})
+
+	var indices []int
+	for _, candidate := range candidates {
+		indices = append(indices, candidate.Index)
+	}
+
+	assert.Equal(t, []int{2, 4, 1, 0, 3}, indices)
+	assert.Equal(t, ExactMatch, candidates[0].Score)
+	assert.Equal(t, FuzzyMatch, candidates[1].Score)
+	assert.Equal(t, 0, candidates[1].Distance)
+	assert.Equal(t, NoMatch, candidates[4].Score)
+}
+
+func TestRank_WithOverrides(t *testing.T) {
+	o := &Overrides{}
+	o.Set(OverrideRules{
+		Ignore: []Selector{{Title: "Ignored"}},
+		Never:  []Never{{A: Selector{Title: "Song"}, B: Selector{ID: "song-1"}}},
+	})
+
+	tracks := []model.LovedTrack{
+		{ID: "song-1", Artist: "Artist", Track: "Song"},
+		{ID: "song-2", Artist: "Artist", Track: "Ignored"},
+	}
+
+	candidates := Rank(tracks, model.LovedTrack{Artist: "Artist", Track: "Song"}, WithOverrides(o))
+
+	assert.Len(t, candidates, 1)
+	assert.Equal(t, NoMatch, candidates[0].Score)
+	assert.Equal(t, "kept apart by overrides", candidates[0].Rule)
+}
@@ -0,0 +1,248 @@
+package matcher
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/agnivade/levenshtein"
+	"github.com/csmith/musiclover/model"
+)
+
+// Matcher compares two tracks and describes how well they match
+type Matcher interface {
+	Explain(a, b model.LovedTrack) Explanation
+}
+
+// Rule is a single step in a Pipeline. Check examines the tracks and, if the
+// rule decides the outcome, sets the explanation's Score and Rule and returns
+// true. Rules that don't apply to the tracks return false, leaving later rules
+// to decide.
+type Rule interface {
+	Name() string
+	Check(a, b model.LovedTrack, e *Explanation) bool
+}
+
+// NewRule creates a rule with the given name from a function with the same
+// behaviour as Rule.Check
+func NewRule(name string, check func(a, b model.LovedTrack, e *Explanation) bool) Rule {
+	return rule{name: name, check: check}
+}
+
+type rule struct {
+	name  string
+	check func(a, b model.LovedTrack, e *Explanation) bool
+}
+
+func (r rule) Name() string {
+	return r.name
+}
+
+func (r rule) Check(a, b model.LovedTrack, e *Explanation) bool {
+	return r.check(a, b, e)
+}
+
+var (
+	// TrackMBIDRule matches tracks with the same recording MBID
+	TrackMBIDRule = NewRule("mbid", func(a, b model.LovedTrack, e *Explanation) bool {
+		if a.TrackMBID == "" || a.TrackMBID != b.TrackMBID {
+			return false
+		}
+		e.Score = TrackMBID
+		e.Rule = "same recording MBID"
+		return true
+	})
+
+	// ISRCRule matches tracks that share an ISRC
+	ISRCRule = NewRule("isrc", func(a, b model.LovedTrack, e *Explanation) bool {
+		if !shareISRC(a, b) {
+			return false
+		}
+		e.Score = ISRC
+		e.Rule = "shared ISRC"
+		return true
+	})
+
+	// AlbumArtistMBIDRule matches tracks with the same album and artist MBIDs
+	AlbumArtistMBIDRule = NewRule("album-artist-mbid", func(a, b model.LovedTrack, e *Explanation) bool {
+		if a.AlbumMBID == "" || a.AlbumMBID != b.AlbumMBID || a.ArtistMBID == "" || a.ArtistMBID != b.ArtistMBID {
+			return false
+		}
+		e.Score = AlbumArtistMBID
+		e.Rule = "same album and artist MBIDs"
+		return true
+	})
+
+	// DurationRule rejects tracks whose lengths are clearly different, so that
+	// later name-based rules can't match them
+	DurationRule = NewRule("duration", func(a, b model.LovedTrack, e *Explanation) bool {
+		if !e.durationsConflict(a, b) {
+			return false
+		}
+		e.Score = NoMatch
+		e.Rule = fmt.Sprintf("durations differ by %s", e.DurationDifference)
+		e.Rejection = "durations conflict"
+		return true
+	})
+
+	// ArtistMBIDRule matches tracks with a main artist MBID in common and the same title
+	ArtistMBIDRule = NewRule("artist-mbid", func(a, b model.LovedTrack, e *Explanation) bool {
+		if !shareArtistMBID(a, b) || a.Track == "" || !strings.EqualFold(a.Track, b.Track) {
+			return false
+		}
+		e.Score = ArtistMBID
+		e.Rule = "same artist MBID and track name"
+		return true
+	})
+
+	// ExactRule matches tracks with the same artist and title, ignoring case
+	ExactRule = NewRule("exact", func(a, b model.LovedTrack, e *Explanation) bool {
+		if !hasNames(a, b) || !strings.EqualFold(a.Artist, b.Artist) || !strings.EqualFold(a.Track, b.Track) {
+			return false
+		}
+		e.Score = ExactMatch
+		e.Rule = "same artist and track name"
+		return true
+	})
+
+	// NormalisedRule matches tracks whose artist and title are the same once normalised
+	NormalisedRule = NewRule("normalised", func(a, b model.LovedTrack, e *Explanation) bool {
+		if !hasNames(a, b) || e.KeyA != e.KeyB {
+			return false
+		}
+		e.Score = FuzzyMatch
+		e.Rule = "same normalised names"
+		return true
+	})
+
+	// FuzzyRule matches tracks whose normalised names are within a small edit
+	// distance, comparing just the primary artists if the full credits differ
+	FuzzyRule = NewRule("fuzzy", func(a, b model.LovedTrack, e *Explanation) bool {
+		if !hasNames(a, b) {
+			return false
+		}
+
+		if e.Distance <= maxLevenshteinDistance {
+			e.Score = FuzzyMatch
+			e.Rule = fmt.Sprintf("normalised names within distance %d", maxLevenshteinDistance)
+			return true
+		}
+
+		// Tracks with multiple artists may be credited differently by each service
+		if e.explainPrimaryArtists(a, b) {
+			e.Score = FuzzyMatch
+			e.Rule = fmt.Sprintf("primary artist and track name within distance %d", maxLevenshteinDistance)
+			return true
+		}
+
+		return false
+	})
+
+	// DefaultRules are the rules used if none are configured, in order
+	DefaultRules = Pipeline{
+		TrackMBIDRule,
+		ISRCRule,
+		AlbumArtistMBIDRule,
+		DurationRule,
+		ArtistMBIDRule,
+		ExactRule,
+		NormalisedRule,
+		FuzzyRule,
+	}
+)
+
+// Pipeline is a Matcher that tries each rule in turn, until one decides the
+// outcome. If none do, the tracks don't match.
+type Pipeline []Rule
+
+// Explain compares two tracks using the pipeline's rules
+func (p Pipeline) Explain(a, b model.LovedTrack) Explanation {
+	return p.explain(a, b, nil)
+}
+
+// explain compares two tracks using the pipeline's rules, looking up
+// normalised names in the given cache
+func (p Pipeline) explain(a, b model.LovedTrack, n *names) Explanation {
+	e := Explanation{Distance: -1, DurationDifference: durationDifference(a, b), names: n}
+
+	if hasNames(a, b) {
+		e.KeyA = n.forMatching(a.Artist) + "|" + n.title(a.Track)
+		e.KeyB = n.forMatching(b.Artist) + "|" + n.title(b.Track)
+		e.Distance = levenshtein.ComputeDistance(e.KeyA, e.KeyB)
+	}
+
+	decided := false
+	for _, r := range p {
+		if r.Check(a, b, &e) {
+			decided = true
+			break
+		}
+	}
+
+	if !decided {
+		e.Score = NoMatch
+		e.Rule = "no rule matched"
+	}
+
+	if e.Score != NoMatch && e.Score < ISRC && a.Album != "" && b.Album != "" {
+		if n.album(a.Album) == n.album(b.Album) {
+			e.Rule += ", same album"
+		} else {
+			e.Rule += ", different album"
+		}
+	}
+
+	switch {
+	case e.Score >= ISRC:
+		e.Confidence = 1
+	case e.Score == ArtistMBID || e.Score == AlbumArtistMBID:
+		// Shared identifiers make us more confident, but don't guarantee a match
+		c := confidence(a, b, n)
+		e.Confidence = c + (1-c)/2
+	default:
+		e.Confidence = confidence(a, b, n)
+	}
+
+	e.names = nil
+	return e
+}
+
+// ParseRules builds a pipeline from a comma-separated list of rule names. The
+// "overrides" rule applies the given overrides; "default" expands to all the
+// default rules.
+func ParseRules(spec string, overrides *Overrides) (Pipeline, error) {
+	var pipeline Pipeline
+	for _, name := range strings.Split(spec, ",") {
+		name = strings.TrimSpace(name)
+		switch name {
+		case "":
+			continue
+		case "overrides":
+			pipeline = append(pipeline, overrides)
+			continue
+		case "default":
+			pipeline = append(pipeline, DefaultRules...)
+			continue
+		}
+
+		found := false
+		for _, r := range DefaultRules {
+			if r.Name() == name {
+				pipeline = append(pipeline, r)
+				found = true
+			}
+		}
+		if !found {
+			return nil, fmt.Errorf("unknown match rule: %s", name)
+		}
+	}
+
+	if len(pipeline) == 0 {
+		return nil, fmt.Errorf("no match rules given")
+	}
+	return pipeline, nil
+}
+
+// hasNames determines whether both tracks have an artist and title
+func hasNames(a, b model.LovedTrack) bool {
+	return a.Artist != "" && b.Artist != "" && a.Track != "" && b.Track != ""
+}
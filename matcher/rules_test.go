@@ -0,0 +1,86 @@
+package matcher
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/csmith/musiclover/model"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPipeline(t *testing.T) {
+	a := model.LovedTrack{Artist: "The Artist", Track: "Song", TrackMBID: "mbid-1"}
+	b := model.LovedTrack{Artist: "Artist", Track: "Song"}
+
+	assert.Equal(t, FuzzyMatch, DefaultRules.Explain(a, b).Score)
+	assert.Equal(t, "same normalised names", DefaultRules.Explain(a, b).Rule)
+
+	mbidOnly := Pipeline{TrackMBIDRule}
+	assert.Equal(t, NoMatch, mbidOnly.Explain(a, b).Score)
+	assert.Equal(t, TrackMBID, mbidOnly.Explain(a, model.LovedTrack{TrackMBID: "mbid-1"}).Score)
+
+	exactOnly := Pipeline{ExactRule}
+	assert.Equal(t, NoMatch, exactOnly.Explain(a, b).Score)
+	assert.Equal(t, ExactMatch, exactOnly.Explain(a, model.LovedTrack{Artist: "the artist", Track: "song"}).Score)
+}
+
+func TestPipeline_CustomRule(t *testing.T) {
+	sameTitle := NewRule("same-title", func(a, b model.LovedTrack, e *Explanation) bool {
+		if !strings.EqualFold(a.Track, b.Track) {
+			return false
+		}
+		e.Score = FuzzyMatch
+		e.Rule = "same title"
+		return true
+	})
+
+	pipeline := Pipeline{TrackMBIDRule, sameTitle}
+	e := pipeline.Explain(model.LovedTrack{Artist: "One", Track: "Song"}, model.LovedTrack{Artist: "Two", Track: "song"})
+	assert.Equal(t, FuzzyMatch, e.Score)
+	assert.Equal(t, "same title", e.Rule)
+	assert.Equal(t, "same-title", sameTitle.Name())
+
+	tracks := []model.LovedTrack{
+		{ID: "1", Artist: "Other", Track: "Other"},
+		{ID: "2", Artist: "Someone Else", Track: "Song"},
+	}
+	assert.Equal(t, 1, Find(tracks, model.LovedTrack{Artist: "Artist", Track: "Song"}, WithMatcher(pipeline)))
+	assert.Equal(t, -1, Find(tracks, model.LovedTrack{Artist: "Artist", Track: "Song"}))
+}
+
+func TestPipeline_Overrides(t *testing.T) {
+	o := &Overrides{}
+	o.Set(OverrideRules{Never: []Never{{A: Selector{Title: "Song"}, B: Selector{ID: "1"}}}})
+
+	desired := []model.LovedTrack{{Artist: "Artist", Track: "Song"}}
+	actual := []model.LovedTrack{{ID: "1", Artist: "Artist", Track: "Song"}}
+
+	assert.Empty(t, Segment(desired, actual, WithOverrides(o)).Matched)
+	assert.Empty(t, Segment(desired, actual, WithOverrides(o), WithMatcher(Pipeline{o, ExactRule})).Matched)
+	assert.Len(t, Segment(desired, actual, WithOverrides(o), WithMatcher(Pipeline{ExactRule})).Matched, 1)
+}
+
+func TestParseRules(t *testing.T) {
+	o := &Overrides{}
+
+	pipeline, err := ParseRules("overrides, mbid,isrc", o)
+	require.NoError(t, err)
+	require.Len(t, pipeline, 3)
+	assert.Equal(t, "overrides", pipeline[0].Name())
+	assert.Equal(t, "mbid", pipeline[1].Name())
+	assert.Equal(t, "isrc", pipeline[2].Name())
+
+	pipeline, err = ParseRules("default", o)
+	require.NoError(t, err)
+	require.Len(t, pipeline, len(DefaultRules))
+	for i := range pipeline {
+		assert.Equal(t, DefaultRules[i].Name(), pipeline[i].Name())
+	}
+
+	_, err = ParseRules("mbid,magic", o)
+	assert.Error(t, err)
+
+	_, err = ParseRules("", o)
+	assert.Error(t, err)
+}
@@ -7,53 +7,127 @@ import (
 )
 
 type SegmentResult struct {
-	Matched []model.LovedTrack
-	Missing []model.LovedTrack
-	Extra   []model.LovedTrack
+	// Pairs contains each matched desired track along with the actual track it matched
+	Pairs []Pair
+	// Duplicates contains tracks left over after pairing that are copies of a
+	// paired track on the same side (see WithDuplicates), along with the other
+	// side of that pair. The explanation describes how the leftover track
+	// matched the paired one. Desired tracks here are included in Matched,
+	// and actual tracks aren't included in Extra.
+	Duplicates []Pair
+	Matched    []model.LovedTrack
+	Missing    []model.LovedTrack
+	Extra      []model.LovedTrack
+	Ignored    []model.LovedTrack
+}
+
+// Pair is a desired track and the actual track it was matched with
+type Pair struct {
+	Desired model.LovedTrack
+	Actual  model.LovedTrack
+	Explanation
 }
 
 type matchCandidate struct {
 	desiredIndex int
 	actualIndex  int
-	score        Score
+	explanation  Explanation
 }
 
-// Segment compares desired tracks against actual tracks
-func Segment(desired []model.LovedTrack, actual []model.LovedTrack) SegmentResult {
+// Segment compares desired tracks against actual tracks. Pairings are
+// consulted if configured, but the resulting pairs aren't recorded; see
+// Pairings.Replace.
+func Segment(desired []model.LovedTrack, actual []model.LovedTrack, opts ...Option) SegmentResult {
+	c := configFor(opts)
 	result := SegmentResult{
-		Matched: make([]model.LovedTrack, 0),
-		Missing: make([]model.LovedTrack, 0),
-		Extra:   make([]model.LovedTrack, 0),
+		Pairs:      make([]Pair, 0),
+		Duplicates: make([]Pair, 0),
+		Matched:    make([]model.LovedTrack, 0),
+		Missing:    make([]model.LovedTrack, 0),
+		Extra:      make([]model.LovedTrack, 0),
+		Ignored:    make([]model.LovedTrack, 0),
+	}
+
+	desired = result.filterIgnored(c, desired)
+	actual = result.filterIgnored(c, actual)
+
+	matchedDesired := make(map[int]bool)
+	matchedActual := make(map[int]bool)
+
+	// Pairings remembered from previous runs take precedence
+	if c.pairings != nil {
+		index := lazyIdentities(actual)
+		for i := range desired {
+			j, explanation, ok := c.remembered(desired[i], actual, index, func(j int) bool { return !matchedActual[j] })
+			if ok {
+				matchedDesired[i] = true
+				matchedActual[j] = true
+				result.Pairs = append(result.Pairs, Pair{
+					Desired:     desired[i],
+					Actual:      actual[j],
+					Explanation: explanation,
+				})
+			}
+		}
 	}
 
 	// Find all possible matches
 	var candidates []matchCandidate
 	for i, desiredTrack := range desired {
+		if matchedDesired[i] {
+			continue
+		}
+
 		for j, actualTrack := range actual {
-			score := Match(desiredTrack, actualTrack)
-			if score != NoMatch {
+			if matchedActual[j] {
+				continue
+			}
+
+			explanation := c.explain(desiredTrack, actualTrack)
+			if explanation.Score != NoMatch {
 				candidates = append(candidates, matchCandidate{
 					desiredIndex: i,
 					actualIndex:  j,
-					score:        score,
+					explanation:  explanation,
 				})
 			}
 		}
 	}
 
 	// Sort by score descending
-	sort.Slice(candidates, func(i, j int) bool {
-		return candidates[i].score > candidates[j].score
+	sort.SliceStable(candidates, func(i, j int) bool {
+		return better(candidates[i].explanation, candidates[j].explanation)
 	})
 
 	// Greedy matching: pick best scores first
-	matchedDesired := make(map[int]bool)
-	matchedActual := make(map[int]bool)
-
 	for _, candidate := range candidates {
 		if !matchedDesired[candidate.desiredIndex] && !matchedActual[candidate.actualIndex] {
 			matchedDesired[candidate.desiredIndex] = true
 			matchedActual[candidate.actualIndex] = true
+			result.Pairs = append(result.Pairs, Pair{
+				Desired:     desired[candidate.desiredIndex],
+				Actual:      actual[candidate.actualIndex],
+				Explanation: candidate.explanation,
+			})
+		}
+	}
+
+	// Leftover tracks that are copies of paired ones are already accounted for
+	if c.duplicates != NoMatch {
+		paired := len(result.Pairs)
+		for i := range desired {
+			if !matchedDesired[i] {
+				matchedDesired[i] = result.addDuplicate(c, desired[i], paired, func(pair Pair) (model.LovedTrack, Pair) {
+					return pair.Desired, Pair{Desired: desired[i], Actual: pair.Actual}
+				})
+			}
+		}
+		for j := range actual {
+			if !matchedActual[j] {
+				matchedActual[j] = result.addDuplicate(c, actual[j], paired, func(pair Pair) (model.LovedTrack, Pair) {
+					return pair.Actual, Pair{Desired: pair.Desired, Actual: actual[j]}
+				})
+			}
 		}
 	}
 
@@ -74,3 +148,35 @@ func Segment(desired []model.LovedTrack, actual []model.LovedTrack) SegmentResul
 
 	return result
 }
+
+// addDuplicate checks whether the track is a copy of the track on the same
+// side of any of the first n pairs, as returned by pairFor along with the
+// duplicate pair to record. If so, the duplicate is recorded.
+func (r *SegmentResult) addDuplicate(c *config, track model.LovedTrack, n int, pairFor func(Pair) (model.LovedTrack, Pair)) bool {
+	for _, pair := range r.Pairs[:n] {
+		original, duplicate := pairFor(pair)
+		duplicate.Explanation = c.explain(original, track)
+		if c.copies(duplicate.Score) {
+			r.Duplicates = append(r.Duplicates, duplicate)
+			return true
+		}
+	}
+	return false
+}
+
+// filterIgnored removes any tracks that the overrides say to ignore, recording them in the result
+func (r *SegmentResult) filterIgnored(c *config, tracks []model.LovedTrack) []model.LovedTrack {
+	if c.overrides == nil {
+		return tracks
+	}
+
+	filtered := make([]model.LovedTrack, 0, len(tracks))
+	for _, track := range tracks {
+		if c.overrides.ignored(track, c.names) {
+			r.Ignored = append(r.Ignored, track)
+		} else {
+			filtered = append(filtered, track)
+		}
+	}
+	return filtered
+}
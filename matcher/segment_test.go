@@ -0,0 +1,94 @@
+package matcher
+
+import (
+	"testing"
+
+	"github.com/csmith/musiclover/model"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSegment(t *testing.T) {
+	desired := []model.LovedTrack{
+		{Artist: "Artist", Track: "Song One", TrackMBID: "mbid-1"},
+		{Artist: "Artist", Track: "Song Two"},
+		{Artist: "Artist", Track: "Song Three"},
+	}
+	actual := []model.LovedTrack{
+		{Artist: "Different", Track: "Different", TrackMBID: "mbid-1"},
+		{Artist: "Artist", Track: "Song Two (Remastered)"},
+		{Artist: "Artist", Track: "Song Four Hundred"},
+	}
+
+	result := Segment(desired, actual)
+
+	assert.Equal(t, []model.LovedTrack{desired[0], desired[1]}, result.Matched)
+	assert.Equal(t, []model.LovedTrack{desired[2]}, result.Missing)
+	assert.Equal(t, []model.LovedTrack{actual[2]}, result.Extra)
+
+	assert.Len(t, result.Pairs, 2)
+	assert.Equal(t, actual[0], result.Pairs[0].Actual)
+	assert.Equal(t, TrackMBID, result.Pairs[0].Score)
+	assert.Equal(t, 1.0, result.Pairs[0].Confidence)
+	assert.Equal(t, actual[1], result.Pairs[1].Actual)
+	assert.Equal(t, FuzzyMatch, result.Pairs[1].Score)
+	assert.Less(t, result.Pairs[1].Confidence, 1.0)
+}
+
+func TestSegment_PrefersConfidentPairs(t *testing.T) {
+	desired := []model.LovedTrack{
+		{Artist: "Artist", Track: "Song Name"},
+	}
+	actual := []model.LovedTrack{
+		{Artist: "Artist", Track: "Song Nmae"},
+		{Artist: "Artist", Track: "Song Name (Live)"},
+	}
+
+	result := Segment(desired, actual)
+
+	assert.Equal(t, actual[1], result.Pairs[0].Actual)
+	assert.Equal(t, []model.LovedTrack{actual[0]}, result.Extra)
+}
+
+func TestSegment_Duplicates(t *testing.T) {
+	desired := []model.LovedTrack{
+		{Artist: "Artist", Track: "Song", ISRCs: []string{"GBAAA0000001"}},
+		{Artist: "Artist", Track: "Other Song"},
+	}
+	actual := []model.LovedTrack{
+		{ID: "1", Artist: "Artist", Track: "Song", Album: "Album", ISRCs: []string{"GBAAA0000001"}},
+		{ID: "2", Artist: "Artist", Track: "Song", Album: "Album (Deluxe Edition)", ISRCs: []string{"GBAAA0000001"}},
+		{ID: "3", Artist: "Artist", Track: "Song", Album: "Live at Leeds"},
+	}
+
+	result := Segment(desired, actual)
+	assert.Equal(t, []model.LovedTrack{actual[1], actual[2]}, result.Extra)
+	assert.Empty(t, result.Duplicates)
+
+	result = Segment(desired, actual, WithDuplicates(ISRC))
+	assert.Equal(t, []model.LovedTrack{desired[0]}, result.Matched)
+	assert.Equal(t, []model.LovedTrack{desired[1]}, result.Missing)
+	assert.Equal(t, []model.LovedTrack{actual[2]}, result.Extra)
+	require.Len(t, result.Duplicates, 1)
+	assert.Equal(t, desired[0], result.Duplicates[0].Desired)
+	assert.Equal(t, actual[1], result.Duplicates[0].Actual)
+	assert.Equal(t, ISRC, result.Duplicates[0].Score)
+}
+
+func TestSegment_DesiredDuplicates(t *testing.T) {
+	desired := []model.LovedTrack{
+		{ID: "1", Artist: "Artist", Track: "Song", Album: "Album", TrackMBID: "mbid-1"},
+		{ID: "2", Artist: "Artist", Track: "Song", Album: "Greatest Hits", TrackMBID: "mbid-1"},
+	}
+	actual := []model.LovedTrack{
+		{Artist: "Artist", Track: "Song", TrackMBID: "mbid-1"},
+	}
+
+	result := Segment(desired, actual, WithDuplicates(TrackMBID))
+	assert.Equal(t, desired, result.Matched)
+	assert.Empty(t, result.Missing)
+	assert.Empty(t, result.Extra)
+	require.Len(t, result.Duplicates, 1)
+	assert.Equal(t, desired[1], result.Duplicates[0].Desired)
+	assert.Equal(t, actual[0], result.Duplicates[0].Actual)
+}
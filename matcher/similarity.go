@@ -0,0 +1,154 @@
+package matcher
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/csmith/musiclover/model"
+)
+
+// Weights used when combining similarities into an overall confidence
+const (
+	titleWeight    = 0.55
+	artistWeight   = 0.45
+	durationWeight = 0.2
+	albumWeight    = 0.1
+
+	// unknownDurationSimilarity is used when either duration is unknown, so
+	// that tracks with closely matching durations rank above those without
+	unknownDurationSimilarity = 0.75
+)
+
+// FormatConfidence formats a confidence value as a percentage, e.g. "92%"
+func FormatConfidence(confidence float64) string {
+	return fmt.Sprintf("%.0f%%", confidence*100)
+}
+
+// confidence estimates how likely it is that two tracks are the same
+// recording, from 0 (certainly not) to 1 (certainly). It only considers the
+// tracks' names, albums and durations; identifiers are handled by the caller.
+// Normalised names are looked up in the given cache.
+func confidence(a, b model.LovedTrack, n *names) float64 {
+	if a.Track == "" || b.Track == "" {
+		return 0
+	}
+
+	titleSimilarity := similarity(n.title(a.Track), n.title(b.Track))
+
+	artistSimilarity := similarity(n.forMatching(a.Artist), n.forMatching(b.Artist))
+	aPrimary, bPrimary := n.primaryArtists(a, b)
+	if primary := similarity(n.forMatching(aPrimary), n.forMatching(bPrimary)); primary > artistSimilarity {
+		artistSimilarity = primary
+	}
+
+	result := titleWeight*titleSimilarity + artistWeight*artistSimilarity
+
+	durationSimilarity := unknownDurationSimilarity
+	if difference := durationDifference(a, b); difference >= 0 {
+		durationSimilarity = max(0, 1-float64(difference)/float64(2*maxDurationDifference))
+	}
+	result = (1-durationWeight)*result + durationWeight*durationSimilarity
+
+	if a.Album != "" && b.Album != "" {
+		albumSimilarity := similarity(n.album(a.Album), n.album(b.Album))
+		result = (1-albumWeight)*result + albumWeight*albumSimilarity
+	}
+
+	return result
+}
+
+// similarity compares two strings, returning a value between 0 (completely
+// different) and 1 (identical). It uses whichever of token-set and
+// Jaro-Winkler similarity gives the higher result, so that both reordered
+// words and small typos are tolerated.
+func similarity(a, b string) float64 {
+	if a == "" || b == "" {
+		return 0
+	}
+	if a == b {
+		return 1
+	}
+	return max(tokenSetSimilarity(a, b), jaroWinkler(a, b))
+}
+
+// tokenSetSimilarity returns the Sørensen–Dice coefficient of the sets of
+// words in each string
+func tokenSetSimilarity(a, b string) float64 {
+	aTokens := make(map[string]bool)
+	for _, token := range strings.Fields(a) {
+		aTokens[token] = true
+	}
+
+	bTokens := make(map[string]bool)
+	for _, token := range strings.Fields(b) {
+		bTokens[token] = true
+	}
+
+	if len(aTokens) == 0 || len(bTokens) == 0 {
+		return 0
+	}
+
+	shared := 0
+	for token := range aTokens {
+		if bTokens[token] {
+			shared++
+		}
+	}
+
+	return 2 * float64(shared) / float64(len(aTokens)+len(bTokens))
+}
+
+// jaroWinkler returns the Jaro-Winkler similarity of two strings
+func jaroWinkler(a, b string) float64 {
+	ar, br := []rune(a), []rune(b)
+	if len(ar) == 0 || len(br) == 0 {
+		return 0
+	}
+
+	window := max(len(ar), len(br))/2 - 1
+	window = max(window, 0)
+
+	aMatched := make([]bool, len(ar))
+	bMatched := make([]bool, len(br))
+	matches := 0
+	for i := range ar {
+		start := max(0, i-window)
+		end := min(len(br), i+window+1)
+		for j := start; j < end; j++ {
+			if !bMatched[j] && ar[i] == br[j] {
+				aMatched[i], bMatched[j] = true, true
+				matches++
+				break
+			}
+		}
+	}
+
+	if matches == 0 {
+		return 0
+	}
+
+	transpositions := 0
+	j := 0
+	for i := range ar {
+		if !aMatched[i] {
+			continue
+		}
+		for !bMatched[j] {
+			j++
+		}
+		if ar[i] != br[j] {
+			transpositions++
+		}
+		j++
+	}
+
+	m := float64(matches)
+	jaro := (m/float64(len(ar)) + m/float64(len(br)) + (m-float64(transpositions)/2)/m) / 3
+
+	prefix := 0
+	for prefix < min(4, len(ar), len(br)) && ar[prefix] == br[prefix] {
+		prefix++
+	}
+
+	return jaro + float64(prefix)*0.1*(1-jaro)
+}
@@ -0,0 +1,70 @@
+package matcher
+
+import (
+	"testing"
+	"time"
+
+	"github.com/csmith/musiclover/model"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestJaroWinkler(t *testing.T) {
+	assert.InDelta(t, 0.961, jaroWinkler("martha", "marhta"), 0.001)
+	assert.InDelta(t, 0.840, jaroWinkler("dwayne", "duane"), 0.001)
+	assert.InDelta(t, 0.813, jaroWinkler("dixon", "dicksonx"), 0.001)
+	assert.Equal(t, 0.0, jaroWinkler("abc", "xyz"))
+	assert.Equal(t, 0.0, jaroWinkler("", "xyz"))
+}
+
+func TestTokenSetSimilarity(t *testing.T) {
+	assert.Equal(t, 1.0, tokenSetSimilarity("love will tear us apart", "apart us tear will love"))
+	assert.Equal(t, 0.5, tokenSetSimilarity("one two", "two three"))
+	assert.Equal(t, 0.0, tokenSetSimilarity("one", "two"))
+}
+
+func TestConfidence(t *testing.T) {
+	base := model.LovedTrack{Artist: "Artist", Track: "Song Name", Album: "Album", Duration: 200 * time.Second}
+
+	identical := confidence(base, base, nil)
+	typo := confidence(base, model.LovedTrack{Artist: "Artist", Track: "Song Naem", Album: "Album", Duration: 200 * time.Second}, nil)
+	noDuration := confidence(base, model.LovedTrack{Artist: "Artist", Track: "Song Name", Album: "Album"}, nil)
+	otherAlbum := confidence(base, model.LovedTrack{Artist: "Artist", Track: "Song Name", Album: "Something Else", Duration: 200 * time.Second}, nil)
+	different := confidence(base, model.LovedTrack{Artist: "Someone", Track: "Another Tune", Duration: 100 * time.Second}, nil)
+
+	assert.Equal(t, 1.0, identical)
+	assert.Less(t, typo, identical)
+	assert.Less(t, noDuration, identical)
+	assert.Less(t, otherAlbum, identical)
+	assert.Less(t, different, 0.6)
+	assert.Equal(t, 0.0, confidence(model.LovedTrack{TrackMBID: "mbid"}, base, nil))
+}
+
+func TestExplain_Confidence(t *testing.T) {
+	assert.Equal(t, 1.0, Explain(model.LovedTrack{TrackMBID: "mbid"}, model.LovedTrack{TrackMBID: "mbid"}).Confidence)
+
+	e := Explain(model.LovedTrack{Artist: "Artist", Track: "Song"}, model.LovedTrack{Artist: "Artist", Track: "Song (Live)"})
+	assert.Equal(t, FuzzyMatch, e.Score)
+	assert.Greater(t, e.Confidence, 0.9)
+	assert.Less(t, e.Confidence, 1.0)
+}
+
+func TestWithMinConfidence(t *testing.T) {
+	tracks := []model.LovedTrack{
+		{Artist: "Artist", Track: "Song Naem"},
+	}
+	target := model.LovedTrack{Artist: "Artist", Track: "Song Name"}
+
+	assert.Equal(t, 0, Find(tracks, target))
+	assert.Equal(t, 0, Find(tracks, target, WithMinConfidence(0.8)))
+	assert.Equal(t, -1, Find(tracks, target, WithMinConfidence(0.99)))
+
+	// Identifier matches aren't affected
+	tracks[0].TrackMBID = "mbid"
+	target.TrackMBID = "mbid"
+	assert.Equal(t, 0, Find(tracks, target, WithMinConfidence(0.99)))
+}
+
+func TestFormatConfidence(t *testing.T) {
+	assert.Equal(t, "92%", FormatConfidence(0.921))
+	assert.Equal(t, "100%", FormatConfidence(1))
+}
@@ -0,0 +1,138 @@
+package matcher
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/csmith/musiclover/model"
+)
+
+// TieBreaker expresses a preference between candidates that match a track
+// equally well
+type TieBreaker struct {
+	// Name identifies the tie-breaker in configuration, e.g. "non-live"
+	Name string
+	// rank scores the candidate as a match for the target; candidates with
+	// the highest rank are preferred
+	rank func(target, candidate model.LovedTrack) int
+}
+
+// preferring ranks candidates that satisfy the given condition above those
+// that don't
+func preferring(prefers func(target, candidate model.LovedTrack) bool) func(target, candidate model.LovedTrack) int {
+	return func(target, candidate model.LovedTrack) int {
+		if prefers(target, candidate) {
+			return 1
+		}
+		return 0
+	}
+}
+
+var (
+	// OriginalAlbum prefers tracks from regular albums over those on
+	// compilations, unless the track being matched is itself from a compilation
+	OriginalAlbum = TieBreaker{
+		Name: "original-album",
+		rank: preferring(func(target, candidate model.LovedTrack) bool {
+			return isCompilation(candidate) == isCompilation(target)
+		}),
+	}
+
+	// NonLive prefers studio recordings over live ones, unless the track being
+	// matched is itself a live recording
+	NonLive = TieBreaker{
+		Name: "non-live",
+		rank: preferring(func(target, candidate model.LovedTrack) bool {
+			return isLive(candidate) == isLive(target)
+		}),
+	}
+
+	// HasMBID prefers tracks that have a recording MBID
+	HasMBID = TieBreaker{
+		Name: "has-mbid",
+		rank: preferring(func(_, candidate model.LovedTrack) bool {
+			return candidate.TrackMBID != ""
+		}),
+	}
+
+	// HighestBitrate prefers the copy of a track with the highest bitrate
+	HighestBitrate = TieBreaker{
+		Name: "bitrate",
+		rank: func(_, candidate model.LovedTrack) int {
+			return candidate.Bitrate
+		},
+	}
+
+	// DefaultTieBreakers are the tie-breakers used if none are configured
+	DefaultTieBreakers = []TieBreaker{OriginalAlbum, NonLive, HasMBID, HighestBitrate}
+)
+
+// ParseTieBreakers parses a comma-separated list of tie-breaker names, in
+// order of priority. An empty string means no tie-breakers.
+func ParseTieBreakers(spec string) ([]TieBreaker, error) {
+	var result []TieBreaker
+	for _, name := range strings.Split(spec, ",") {
+		name = strings.TrimSpace(name)
+		if name == "" {
+			continue
+		}
+
+		found := false
+		for _, t := range DefaultTieBreakers {
+			if t.Name == name {
+				result = append(result, t)
+				found = true
+			}
+		}
+		if !found {
+			return nil, fmt.Errorf("unknown tie-breaker: %s", name)
+		}
+	}
+	return result, nil
+}
+
+// breakTies narrows down equally good candidates using each tie-breaker in
+// turn, keeping those it ranks highest. A tie-breaker has no effect if it
+// ranks all the remaining candidates equally.
+func (c *config) breakTies(target model.LovedTrack, tracks []model.LovedTrack, candidates []Candidate) []Candidate {
+	for _, t := range c.tieBreakers {
+		if len(candidates) <= 1 {
+			break
+		}
+
+		var preferred []Candidate
+		best := 0
+		for i, candidate := range candidates {
+			rank := t.rank(target, tracks[candidate.Index])
+			switch {
+			case i == 0 || rank > best:
+				best = rank
+				preferred = []Candidate{candidate}
+			case rank == best:
+				preferred = append(preferred, candidate)
+			}
+		}
+		candidates = preferred
+	}
+	return candidates
+}
+
+var (
+	// liveTitle matches qualifiers like "(Live)" or "- Live at Wembley"
+	liveTitle = regexp.MustCompile(`(?i)[(\[]live\b|\s-\s+live\b`)
+	// liveAlbum matches album names like "Live at Leeds" or "MTV Unplugged"
+	liveAlbum = regexp.MustCompile(`(?i)[(\[]live\b|\s-\s+live\b|^live (at|from|in)\b|\bunplugged\b`)
+	// compilationAlbum matches album names typically given to compilations
+	compilationAlbum = regexp.MustCompile(`(?i)\b(greatest hits|best of|the very best|anthology|the collection|the essential|the singles|compilation|now that's what i call)\b`)
+)
+
+// isLive guesses whether a track is a live recording from its names
+func isLive(track model.LovedTrack) bool {
+	return liveTitle.MatchString(track.Track) || liveAlbum.MatchString(track.Album)
+}
+
+// isCompilation guesses whether a track is from a compilation from its album name
+func isCompilation(track model.LovedTrack) bool {
+	return compilationAlbum.MatchString(track.Album)
+}
@@ -0,0 +1,182 @@
+package matcher
+
+import (
+	"testing"
+
+	"github.com/csmith/musiclover/model"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSearch_TieBreakers(t *testing.T) {
+	tests := []struct {
+		name     string
+		tracks   []model.LovedTrack
+		target   model.LovedTrack
+		opts     []Option
+		expected int
+	}{
+		{
+			name: "prefers original album over compilation",
+			tracks: []model.LovedTrack{
+				{ID: "1", Artist: "Artist", Track: "Song", Album: "The Very Best of Artist"},
+				{ID: "2", Artist: "Artist", Track: "Song", Album: "Second Album"},
+			},
+			target:   model.LovedTrack{Artist: "Artist", Track: "Song"},
+			expected: 1,
+		},
+		{
+			name: "prefers compilation if target is from one",
+			tracks: []model.LovedTrack{
+				{ID: "1", Artist: "Artist", Track: "Song", Album: "Album"},
+				{ID: "2", Artist: "Artist", Track: "Song", Album: "Greatest Hits"},
+			},
+			target:   model.LovedTrack{Artist: "Artist", Track: "Song", Album: "Greatest Hits (Remastered)"},
+			expected: 1,
+		},
+		{
+			name: "prefers studio over live album",
+			tracks: []model.LovedTrack{
+				{ID: "1", Artist: "Artist", Track: "Song", Album: "Live at Leeds"},
+				{ID: "2", Artist: "Artist", Track: "Song", Album: "Album"},
+			},
+			target:   model.LovedTrack{Artist: "Artist", Track: "Song"},
+			expected: 1,
+		},
+		{
+			name: "prefers track with MBID",
+			tracks: []model.LovedTrack{
+				{ID: "1", Artist: "Artist", Track: "Song", Album: "Album"},
+				{ID: "2", Artist: "Artist", Track: "Song", Album: "Album", TrackMBID: "mbid"},
+			},
+			target:   model.LovedTrack{Artist: "Artist", Track: "Song"},
+			expected: 1,
+		},
+		{
+			name: "prefers highest bitrate",
+			tracks: []model.LovedTrack{
+				{ID: "1", Artist: "Artist", Track: "Song", Album: "Album", Bitrate: 128},
+				{ID: "2", Artist: "Artist", Track: "Song", Album: "Album", Bitrate: 320},
+				{ID: "3", Artist: "Artist", Track: "Song", Album: "Album"},
+			},
+			target:   model.LovedTrack{Artist: "Artist", Track: "Song"},
+			expected: 1,
+		},
+		{
+			name: "tie-breakers are applied in order",
+			tracks: []model.LovedTrack{
+				{ID: "1", Artist: "Artist", Track: "Song", Album: "Greatest Hits", TrackMBID: "mbid"},
+				{ID: "2", Artist: "Artist", Track: "Song", Album: "Album"},
+			},
+			target:   model.LovedTrack{Artist: "Artist", Track: "Song"},
+			opts:     []Option{WithTieBreakers(HasMBID, OriginalAlbum)},
+			expected: 0,
+		},
+		{
+			name: "ambiguous without tie-breakers",
+			tracks: []model.LovedTrack{
+				{ID: "1", Artist: "Artist", Track: "Song", Album: "Greatest Hits"},
+				{ID: "2", Artist: "Artist", Track: "Song", Album: "Album"},
+			},
+			target:   model.LovedTrack{Artist: "Artist", Track: "Song"},
+			opts:     []Option{WithTieBreakers()},
+			expected: -1,
+		},
+		{
+			name: "clear winner is not ambiguous",
+			tracks: []model.LovedTrack{
+				{ID: "1", Artist: "Artist", Track: "Song (Demo)"},
+				{ID: "2", Artist: "Artist", Track: "Song"},
+			},
+			target:   model.LovedTrack{Artist: "Artist", Track: "Song"},
+			opts:     []Option{WithTieBreakers()},
+			expected: 1,
+		},
+		{
+			name: "copies of the same track are not ambiguous",
+			tracks: []model.LovedTrack{
+				{Artist: "Artist", Track: "Song"},
+				{Artist: "artist", Track: "song"},
+			},
+			target:   model.LovedTrack{Artist: "Artist", Track: "Song"},
+			opts:     []Option{WithTieBreakers()},
+			expected: 0,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.expected, Find(tt.tracks, tt.target, tt.opts...))
+		})
+	}
+}
+
+func TestSearch_Ambiguous(t *testing.T) {
+	tracks := []model.LovedTrack{
+		{ID: "1", Artist: "Other", Track: "Other"},
+		{ID: "2", Artist: "Artist", Track: "Song", Album: "First Album"},
+		{ID: "3", Artist: "Artist", Track: "Song", Album: "Second Album"},
+	}
+
+	pairings := &Pairings{}
+	result := Search(tracks, model.LovedTrack{Artist: "Artist", Track: "Song"}, WithPairings(pairings, "test"))
+	assert.Equal(t, -1, result.Index)
+	assert.Equal(t, []int{1, 2}, result.Ambiguous)
+
+	_, ok := pairings.Lookup("test", model.LovedTrack{Artist: "Artist", Track: "Song"}.Identity())
+	assert.False(t, ok, "ambiguous results should not be remembered")
+}
+
+func TestSearch_Copies(t *testing.T) {
+	tracks := []model.LovedTrack{
+		{ID: "1", Artist: "Artist", Track: "Song", Album: "First Album", ISRCs: []string{"GBAAA0000001"}},
+		{ID: "2", Artist: "Artist", Track: "Song", Album: "Second Album", ISRCs: []string{"GBAAA0000001"}},
+		{ID: "3", Artist: "Artist", Track: "Song", Album: "Third Album"},
+	}
+	target := model.LovedTrack{Artist: "Artist", Track: "Song", ISRCs: []string{"GBAAA0000001"}}
+
+	result := Search(tracks, target, WithTieBreakers())
+	assert.Equal(t, []int{0, 1}, result.Ambiguous)
+	assert.Empty(t, Copies(tracks, 0))
+
+	result = Search(tracks, target, WithTieBreakers(), WithDuplicates(ISRC))
+	assert.Equal(t, 0, result.Index)
+	assert.Empty(t, result.Ambiguous)
+	assert.Equal(t, []int{1}, Copies(tracks, result.Index, WithDuplicates(ISRC)))
+	assert.Equal(t, []int{1, 2}, Copies(tracks, result.Index, WithDuplicates(ExactMatch)))
+}
+
+func TestSearch_CopiesWithoutTargetISRC(t *testing.T) {
+	tracks := []model.LovedTrack{
+		{ID: "1", Artist: "Artist", Track: "Song", Album: "Album", ISRCs: []string{"GBAAA0000001"}},
+		{ID: "2", Artist: "Artist", Track: "Song", Album: "Album (Deluxe Edition)", ISRCs: []string{"GBAAA0000001"}},
+	}
+	target := model.LovedTrack{Artist: "Artist", Track: "Song"}
+
+	// The copies are compared with each other, not with the target
+	result := Search(tracks, target, WithTieBreakers(), WithDuplicates(ISRC))
+	assert.Equal(t, 0, result.Index)
+	assert.Empty(t, result.Ambiguous)
+	assert.Equal(t, []int{1}, Copies(tracks, result.Index, WithDuplicates(ISRC)))
+
+	segment := Segment([]model.LovedTrack{target}, tracks, WithDuplicates(ISRC))
+	assert.Empty(t, segment.Extra)
+	require.Len(t, segment.Duplicates, 1)
+	assert.Equal(t, tracks[1], segment.Duplicates[0].Actual)
+	assert.Equal(t, ISRC, segment.Duplicates[0].Score)
+}
+
+func TestParseTieBreakers(t *testing.T) {
+	tieBreakers, err := ParseTieBreakers("has-mbid, non-live")
+	require.NoError(t, err)
+	require.Len(t, tieBreakers, 2)
+	assert.Equal(t, "has-mbid", tieBreakers[0].Name)
+	assert.Equal(t, "non-live", tieBreakers[1].Name)
+
+	tieBreakers, err = ParseTieBreakers("")
+	require.NoError(t, err)
+	assert.Empty(t, tieBreakers)
+
+	_, err = ParseTieBreakers("newest")
+	assert.Error(t, err)
+}
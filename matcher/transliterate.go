@@ -0,0 +1,162 @@
+package matcher
+
+import "strings"
+
+// latinFolds maps accented Latin letters to their unaccented equivalents
+var latinFolds = map[rune]string{
+	'à': "a", 'á': "a", 'â': "a", 'ã': "a", 'ä': "a", 'å': "a", 'ā': "a", 'ă': "a", 'ą': "a",
+	'æ': "ae",
+	'ç': "c", 'ć': "c", 'č': "c",
+	'ď': "d", 'đ': "d", 'ð': "d",
+	'è': "e", 'é': "e", 'ê': "e", 'ë': "e", 'ē': "e", 'ė': "e", 'ę': "e", 'ě': "e",
+	'ğ': "g",
+	'ì': "i", 'í': "i", 'î': "i", 'ï': "i", 'ī': "i", 'į': "i", 'ı': "i",
+	'ł': "l", 'ľ': "l", 'ĺ': "l",
+	'ñ': "n", 'ń': "n", 'ň': "n",
+	'ò': "o", 'ó': "o", 'ô': "o", 'õ': "o", 'ö': "o", 'ø': "o", 'ō': "o", 'ő': "o",
+	'œ': "oe",
+	'ŕ': "r", 'ř': "r",
+	'ś': "s", 'š': "s", 'ş': "s", 'ș': "s", 'ß': "ss",
+	'ť': "t", 'ţ': "t", 'ț': "t", 'þ': "th",
+	'ù': "u", 'ú': "u", 'û': "u", 'ü': "u", 'ū': "u", 'ů': "u", 'ű': "u", 'ų': "u",
+	'ý': "y", 'ÿ': "y",
+	'ź': "z", 'ż': "z", 'ž': "z",
+}
+
+// cyrillic maps lower case Cyrillic letters to Latin, broadly following the
+// conventions used for Russian and Ukrainian names
+var cyrillic = map[rune]string{
+	'а': "a", 'б': "b", 'в': "v", 'г': "g", 'д': "d", 'е': "e", 'ё': "e", 'ж': "zh",
+	'з': "z", 'и': "i", 'й': "y", 'к': "k", 'л': "l", 'м': "m", 'н': "n", 'о': "o",
+	'п': "p", 'р': "r", 'с': "s", 'т': "t", 'у': "u", 'ф': "f", 'х': "kh", 'ц': "ts",
+	'ч': "ch", 'ш': "sh", 'щ': "shch", 'ъ': "", 'ы': "y", 'ь': "", 'э': "e", 'ю': "yu",
+	'я': "ya", 'і': "i", 'ї': "yi", 'є': "ye", 'ґ': "g", 'ў': "u",
+}
+
+// greek maps lower case Greek letters to Latin, using modern pronunciation
+var greek = map[rune]string{
+	'α': "a", 'β': "v", 'γ': "g", 'δ': "d", 'ε': "e", 'ζ': "z", 'η': "i", 'θ': "th",
+	'ι': "i", 'κ': "k", 'λ': "l", 'μ': "m", 'ν': "n", 'ξ': "x", 'ο': "o", 'π': "p",
+	'ρ': "r", 'σ': "s", 'ς': "s", 'τ': "t", 'υ': "y", 'φ': "f", 'χ': "ch", 'ψ': "ps",
+	'ω': "o", 'ά': "a", 'έ': "e", 'ή': "i", 'ί': "i", 'ό': "o", 'ύ': "y", 'ώ': "o",
+	'ϊ': "i", 'ϋ': "y", 'ΐ': "i", 'ΰ': "y",
+}
+
+// hiragana maps hiragana to Hepburn romanisation. Katakana are converted to
+// hiragana before lookup.
+var hiragana = map[rune]string{
+	'あ': "a", 'い': "i", 'う': "u", 'え': "e", 'お': "o",
+	'か': "ka", 'き': "ki", 'く': "ku", 'け': "ke", 'こ': "ko",
+	'が': "ga", 'ぎ': "gi", 'ぐ': "gu", 'げ': "ge", 'ご': "go",
+	'さ': "sa", 'し': "shi", 'す': "su", 'せ': "se", 'そ': "so",
+	'ざ': "za", 'じ': "ji", 'ず': "zu", 'ぜ': "ze", 'ぞ': "zo",
+	'た': "ta", 'ち': "chi", 'つ': "tsu", 'て': "te", 'と': "to",
+	'だ': "da", 'ぢ': "ji", 'づ': "zu", 'で': "de", 'ど': "do",
+	'な': "na", 'に': "ni", 'ぬ': "nu", 'ね': "ne", 'の': "no",
+	'は': "ha", 'ひ': "hi", 'ふ': "fu", 'へ': "he", 'ほ': "ho",
+	'ば': "ba", 'び': "bi", 'ぶ': "bu", 'べ': "be", 'ぼ': "bo",
+	'ぱ': "pa", 'ぴ': "pi", 'ぷ': "pu", 'ぺ': "pe", 'ぽ': "po",
+	'ま': "ma", 'み': "mi", 'む': "mu", 'め': "me", 'も': "mo",
+	'や': "ya", 'ゆ': "yu", 'よ': "yo",
+	'ら': "ra", 'り': "ri", 'る': "ru", 'れ': "re", 'ろ': "ro",
+	'わ': "wa", 'ゐ': "i", 'ゑ': "e", 'を': "o", 'ん': "n", 'ゔ': "vu",
+}
+
+const (
+	// katakanaOffset is the distance between each katakana and its hiragana equivalent
+	katakanaOffset = 'ア' - 'あ'
+	// sokuon is the small "tsu" that doubles the following consonant
+	sokuon = 'っ'
+	// chouon is the katakana long vowel mark
+	chouon = 'ー'
+)
+
+// smallKana are the small kana that modify the previous syllable, e.g. "きゃ" = "kya"
+var smallKana = map[rune]string{
+	'ゃ': "a", 'ゅ': "u", 'ょ': "o",
+	'ぁ': "a", 'ぃ': "i", 'ぅ': "u", 'ぇ': "e", 'ぉ': "o", 'ゎ': "a",
+}
+
+// transliterate converts a lower case string to plain Latin letters where
+// possible, removing accents and romanising Cyrillic, Greek and kana. Other
+// characters are left as they are.
+func transliterate(s string) string {
+	var b strings.Builder
+
+	// Kana syllables are held back until the next character, as a following
+	// small kana may change them
+	var pending string
+	double := false
+
+	for _, r := range s {
+		if r >= 'ァ' && r <= 'ヶ' {
+			r -= katakanaOffset
+		}
+
+		if r == sokuon {
+			double = true
+			continue
+		}
+		if r == chouon {
+			continue
+		}
+		if vowel, ok := smallKana[r]; ok && pending != "" {
+			pending = modifySyllable(pending, r, vowel)
+			continue
+		}
+
+		b.WriteString(pending)
+		pending = ""
+
+		if kana, ok := hiragana[r]; ok {
+			if double && !strings.ContainsRune("aiueon", rune(kana[0])) {
+				if strings.HasPrefix(kana, "ch") {
+					b.WriteByte('t')
+				} else {
+					b.WriteByte(kana[0])
+				}
+			}
+			double = false
+			pending = kana
+			continue
+		}
+
+		if replacement, ok := smallKana[r]; ok {
+			b.WriteString(replacement)
+		} else if replacement, ok := latinFolds[r]; ok {
+			b.WriteString(replacement)
+		} else if replacement, ok := cyrillic[r]; ok {
+			b.WriteString(replacement)
+		} else if replacement, ok := greek[r]; ok {
+			b.WriteString(replacement)
+		} else if r == '・' {
+			b.WriteRune(' ')
+		} else {
+			b.WriteRune(r)
+		}
+	}
+
+	b.WriteString(pending)
+	return b.String()
+}
+
+// modifySyllable combines a syllable with the small kana that follows it
+func modifySyllable(syllable string, small rune, vowel string) string {
+	switch {
+	case small == 'ゃ' || small == 'ゅ' || small == 'ょ':
+		// "shi" + "ya" = "sha", "ki" + "ya" = "kya"
+		if strings.HasSuffix(syllable, "i") {
+			stem := syllable[:len(syllable)-1]
+			if stem == "sh" || stem == "ch" || stem == "j" {
+				return stem + vowel
+			}
+			return stem + "y" + vowel
+		}
+		return syllable + "y" + vowel
+	case len(syllable) > 1:
+		// Extended katakana, e.g. "fu" + "i" = "fi"
+		return syllable[:len(syllable)-1] + vowel
+	default:
+		return syllable + vowel
+	}
+}
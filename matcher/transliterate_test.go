@@ -0,0 +1,36 @@
+package matcher
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTransliterate(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"sigur rós", "sigur ros"},
+		{"björk", "bjork"},
+		{"motörhead", "motorhead"},
+		{"кино", "kino"},
+		{"аквариум", "akvarium"},
+		{"океан ельзи", "okean elzi"},
+		{"μίκης θεοδωράκης", "mikis theodorakis"},
+		{"さかなクション", "sakanakushon"},
+		{"きゃりーぱみゅぱみゅ", "kyaripamyupamyu"},
+		{"がっこう", "gakkou"},
+		{"まっちゃ", "matcha"},
+		{"しょうじょ", "shoujo"},
+		{"ファイナル・ファンタジー", "fainaru fantaji"},
+		{"坂本龍一", "坂本龍一"},
+		{"plain ascii", "plain ascii"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			assert.Equal(t, tt.expected, transliterate(tt.input))
+		})
+	}
+}
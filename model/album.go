@@ -0,0 +1,16 @@
+package model
+
+import "time"
+
+// LovedAlbum represents a loved/starred album
+type LovedAlbum struct {
+	// ID is a service-specific identifier for the album, such as a Subsonic album ID
+	ID     string
+	Title  string
+	Artist string
+	// MBID is the MusicBrainz release MBID of the album
+	MBID       string
+	ArtistMBID string
+	// LovedAt is when the album was loved, or zero if unknown
+	LovedAt time.Time
+}
@@ -0,0 +1,96 @@
+package model
+
+import (
+	"strings"
+	"time"
+)
+
+// ArtistCredit is a single artist credited on a track
+type ArtistCredit struct {
+	Name     string
+	MBID     string
+	Featured bool
+}
+
+// LovedArtist represents a loved/starred artist
+type LovedArtist struct {
+	// ID is a service-specific identifier for the artist, such as a Subsonic artist ID
+	ID   string
+	Name string
+	MBID string
+	// LovedAt is when the artist was loved, or zero if unknown
+	LovedAt time.Time
+}
+
+// featuringSeparators introduce the featured artists in a credit string
+var featuringSeparators = []string{" (featuring ", " (feat. ", " (feat ", " (ft. ", " (ft ", " featuring ", " feat. ", " feat ", " ft. ", " ft "}
+
+// artistSeparators split multiple main (or featured) artists in a credit string
+var artistSeparators = []string{", ", " & ", " x ", " vs. ", " vs ", " + ", " / ", "; "}
+
+// ParseArtistCredits splits a combined artist string such as "A & B feat. C"
+// into separate credits. Artists after a "feat." or similar are marked as
+// featured. If the string doesn't contain multiple artists, a single credit is
+// returned with the whole name.
+func ParseArtistCredits(artist string) []ArtistCredit {
+	artist = strings.TrimSpace(artist)
+	if artist == "" {
+		return nil
+	}
+
+	main, featured := artist, ""
+	lower := strings.ToLower(artist)
+	for _, sep := range featuringSeparators {
+		if idx := strings.Index(lower, sep); idx != -1 {
+			main = artist[:idx]
+			featured = strings.TrimSuffix(artist[idx+len(sep):], ")")
+			break
+		}
+	}
+
+	var credits []ArtistCredit
+	for _, name := range splitArtists(main) {
+		credits = append(credits, ArtistCredit{Name: name})
+	}
+	for _, name := range splitArtists(featured) {
+		credits = append(credits, ArtistCredit{Name: name, Featured: true})
+	}
+	return credits
+}
+
+// splitArtists splits a list of artists such as "A, B and C" into its names
+func splitArtists(s string) []string {
+	lower := strings.ToLower(s)
+
+	// Only treat "and" as a separator in lists ("A, B and C"), as it's often part
+	// of a band's name.
+	separators := artistSeparators
+	if strings.Contains(lower, ", ") {
+		separators = append(separators[:len(separators):len(separators)], " and ")
+	}
+
+	names := []string{s}
+	for _, sep := range separators {
+		var split []string
+		for _, name := range names {
+			for {
+				idx := strings.Index(strings.ToLower(name), sep)
+				if idx == -1 {
+					break
+				}
+				split = append(split, name[:idx])
+				name = name[idx+len(sep):]
+			}
+			split = append(split, name)
+		}
+		names = split
+	}
+
+	var result []string
+	for _, name := range names {
+		if name = strings.TrimSpace(name); name != "" {
+			result = append(result, name)
+		}
+	}
+	return result
+}
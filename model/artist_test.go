@@ -0,0 +1,102 @@
+package model
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseArtistCredits(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		expected []ArtistCredit
+	}{
+		{
+			name:     "empty",
+			input:    "",
+			expected: nil,
+		},
+		{
+			name:     "single artist",
+			input:    "Artist",
+			expected: []ArtistCredit{{Name: "Artist"}},
+		},
+		{
+			name:     "ampersand",
+			input:    "Artist A & Artist B",
+			expected: []ArtistCredit{{Name: "Artist A"}, {Name: "Artist B"}},
+		},
+		{
+			name:     "x",
+			input:    "A x B",
+			expected: []ArtistCredit{{Name: "A"}, {Name: "B"}},
+		},
+		{
+			name:     "list with and",
+			input:    "A, B and C",
+			expected: []ArtistCredit{{Name: "A"}, {Name: "B"}, {Name: "C"}},
+		},
+		{
+			name:     "and without a list",
+			input:    "Florence and the Machine",
+			expected: []ArtistCredit{{Name: "Florence and the Machine"}},
+		},
+		{
+			name:     "versus",
+			input:    "A vs. B",
+			expected: []ArtistCredit{{Name: "A"}, {Name: "B"}},
+		},
+		{
+			name:     "featuring",
+			input:    "A feat. B",
+			expected: []ArtistCredit{{Name: "A"}, {Name: "B", Featured: true}},
+		},
+		{
+			name:     "featuring in parentheses",
+			input:    "A (ft. B & C)",
+			expected: []ArtistCredit{{Name: "A"}, {Name: "B", Featured: true}, {Name: "C", Featured: true}},
+		},
+		{
+			name:     "multiple main and featured",
+			input:    "A & B Featuring C",
+			expected: []ArtistCredit{{Name: "A"}, {Name: "B"}, {Name: "C", Featured: true}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.expected, ParseArtistCredits(tt.input))
+		})
+	}
+}
+
+func TestLovedTrack_PrimaryArtist(t *testing.T) {
+	assert.Equal(t, ArtistCredit{Name: "A"}, LovedTrack{Artist: "A feat. B"}.PrimaryArtist())
+	assert.Equal(t, ArtistCredit{Name: "B", MBID: "mbid-b"}, LovedTrack{
+		Artist: "A feat. B",
+		Artists: []ArtistCredit{
+			{Name: "A", Featured: true},
+			{Name: "B", MBID: "mbid-b"},
+		},
+	}.PrimaryArtist())
+	assert.Equal(t, ArtistCredit{}, LovedTrack{}.PrimaryArtist())
+}
+
+func TestLovedTrack_MainArtistMBIDs(t *testing.T) {
+	track := LovedTrack{
+		ArtistMBID: "mbid-a",
+		Artists: []ArtistCredit{
+			{Name: "A", MBID: "mbid-a"},
+			{Name: "B", MBID: "mbid-b"},
+			{Name: "C", MBID: "mbid-c", Featured: true},
+		},
+	}
+	assert.Equal(t, []string{"mbid-a", "mbid-b"}, track.MainArtistMBIDs())
+}
+
+func TestLovedTrack_Identity(t *testing.T) {
+	assert.Equal(t, "id:123", LovedTrack{ID: "123", TrackMBID: "mbid", Artist: "A", Track: "T"}.Identity())
+	assert.Equal(t, "mbid:mbid", LovedTrack{TrackMBID: "mbid", Artist: "A", Track: "T"}.Identity())
+	assert.Equal(t, "name:a|t", LovedTrack{Artist: "A", Track: "T"}.Identity())
+}
@@ -6,3 +6,59 @@ type Source interface {
 	Love(tracks []LovedTrack) error
 	Unlove(tracks []LovedTrack) error
 }
+
+// AlbumSource is implemented by sources that can also love whole albums
+type AlbumSource interface {
+	LovedAlbums() ([]LovedAlbum, error)
+	LoveAlbums(albums []LovedAlbum) error
+	UnloveAlbums(albums []LovedAlbum) error
+}
+
+// ArtistSource is implemented by sources that can also love artists
+type ArtistSource interface {
+	LovedArtists() ([]LovedArtist, error)
+	LoveArtists(artists []LovedArtist) error
+	UnloveArtists(artists []LovedArtist) error
+}
+
+// KindSource is implemented by sources that can only sync some kinds of
+// loves, depending on how they're configured
+type KindSource interface {
+	// Syncs determines whether the kind of love can be synced, where kind is
+	// "tracks", "albums" or "artists"
+	Syncs(kind string) bool
+}
+
+// Syncs determines whether the source can sync the kind of love. Every kind
+// the source has methods for can be synced unless it's a KindSource.
+func Syncs(src any, kind string) bool {
+	if limited, ok := src.(KindSource); ok {
+		return limited.Syncs(kind)
+	}
+	return true
+}
+
+// RatingSource is implemented by sources that let tracks be rated from 1 to 5
+type RatingSource interface {
+	// RatedTracks returns every track that has a rating
+	RatedTracks() ([]LovedTrack, error)
+	// Rate sets each track's rating to its Rating, removing it if that's zero
+	Rate(tracks []LovedTrack) error
+}
+
+// LimitedRatingSource is implemented by rating sources that can only hold
+// some of the ratings from 1 to 5
+type LimitedRatingSource interface {
+	RatingSource
+	// CanRate determines whether tracks can be given the rating
+	CanRate(rating int) bool
+}
+
+// CanRate determines whether the source can give tracks the rating. Every
+// rating can be given unless the source is a LimitedRatingSource.
+func CanRate(src any, rating int) bool {
+	if limited, ok := src.(LimitedRatingSource); ok {
+		return limited.CanRate(rating)
+	}
+	return true
+}
@@ -0,0 +1,34 @@
+package model
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type testRatingSource struct{}
+
+func (testRatingSource) RatedTracks() ([]LovedTrack, error) { return nil, nil }
+func (testRatingSource) Rate([]LovedTrack) error            { return nil }
+
+type testLimitedRatingSource struct {
+	testRatingSource
+}
+
+func (testLimitedRatingSource) CanRate(rating int) bool { return rating == 1 }
+
+func TestCanRate(t *testing.T) {
+	assert.True(t, CanRate(testRatingSource{}, 3))
+	assert.True(t, CanRate(testLimitedRatingSource{}, 1))
+	assert.False(t, CanRate(testLimitedRatingSource{}, 3))
+}
+
+type testKindSource struct{}
+
+func (testKindSource) Syncs(kind string) bool { return kind == "tracks" }
+
+func TestSyncs(t *testing.T) {
+	assert.True(t, Syncs(testRatingSource{}, "albums"))
+	assert.True(t, Syncs(testKindSource{}, "tracks"))
+	assert.False(t, Syncs(testKindSource{}, "albums"))
+}
@@ -1,11 +1,76 @@
 package model
 
+import (
+	"strings"
+	"time"
+)
+
 // LovedTrack represents a loved/starred track with metadata
 type LovedTrack struct {
+	// ID is a service-specific identifier for the track, such as a Subsonic song ID
+	ID         string
 	Track      string
 	Artist     string
 	Album      string
 	TrackMBID  string
 	ArtistMBID string
 	AlbumMBID  string
+	// ISRCs contains the International Standard Recording Codes for the track.
+	// A recording may have several, e.g. if it was released by multiple labels.
+	ISRCs []string
+	// Duration is the length of the track, or zero if unknown
+	Duration time.Duration
+	// Artists contains the individual artists credited on the track, main artists first
+	Artists []ArtistCredit
+	// Bitrate is the bitrate of this copy of the track in kbps, or zero if unknown
+	Bitrate int
+	// LovedAt is when the track was loved, or zero if unknown
+	LovedAt time.Time
+	// Rating is the user's rating of the track from 1 to 5, or zero if it's
+	// unrated or the service doesn't have ratings
+	Rating int
+}
+
+// PrimaryArtist returns the first main artist credited on the track. If there
+// are no structured credits, they are parsed from the Artist field.
+func (t LovedTrack) PrimaryArtist() ArtistCredit {
+	credits := t.Artists
+	if len(credits) == 0 {
+		credits = ParseArtistCredits(t.Artist)
+	}
+
+	for _, credit := range credits {
+		if !credit.Featured {
+			return credit
+		}
+	}
+	return ArtistCredit{}
+}
+
+// MainArtistMBIDs returns the MBIDs of all main (non-featured) artists on the track
+func (t LovedTrack) MainArtistMBIDs() []string {
+	var mbids []string
+	if t.ArtistMBID != "" {
+		mbids = append(mbids, t.ArtistMBID)
+	}
+	for _, credit := range t.Artists {
+		if !credit.Featured && credit.MBID != "" && credit.MBID != t.ArtistMBID {
+			mbids = append(mbids, credit.MBID)
+		}
+	}
+	return mbids
+}
+
+// Identity returns a string that identifies the track within the service it
+// came from: its service-specific ID if it has one, otherwise its recording
+// MBID, otherwise its artist and title.
+func (t LovedTrack) Identity() string {
+	switch {
+	case t.ID != "":
+		return "id:" + t.ID
+	case t.TrackMBID != "":
+		return "mbid:" + t.TrackMBID
+	default:
+		return "name:" + strings.ToLower(t.Artist+"|"+t.Track)
+	}
 }
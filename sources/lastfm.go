@@ -2,6 +2,7 @@ package sources
 
 import (
 	"log/slog"
+	"strings"
 	"sync"
 
 	"github.com/csmith/musiclover/model"
@@ -15,9 +16,13 @@ type Lastfm struct {
 	Secret   string
 	Username string
 	Password string
+	// FetchDetails enables looking up each loved track to find its duration,
+	// at the cost of an extra request per track
+	FetchDetails bool
 
-	mu     sync.Mutex
-	client *session.Client
+	mu      sync.Mutex
+	client  *session.Client
+	details map[string]*lastfm.TrackInfo
 }
 
 // LovedTracks retrieves loved tracks from Last.fm
@@ -48,6 +53,7 @@ func (l *Lastfm) LovedTracks() ([]model.LovedTrack, error) {
 				TrackMBID:  track.MBID,
 				Artist:     track.Artist.Name,
 				ArtistMBID: track.Artist.MBID,
+				LovedAt:    track.LovedAt.Time(),
 			})
 		}
 
@@ -58,9 +64,50 @@ func (l *Lastfm) LovedTracks() ([]model.LovedTrack, error) {
 	}
 
 	slog.Debug("Retrieved loved tracks", "count", len(tracks), "source", "lastfm")
+
+	if l.FetchDetails {
+		l.addDetails(client, tracks)
+	}
+
 	return tracks, nil
 }
 
+// addDetails looks up extra information about each track that isn't included
+// in the loved tracks response. Results are cached for the life of the source.
+func (l *Lastfm) addDetails(client *session.Client, tracks []model.LovedTrack) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.details == nil {
+		l.details = make(map[string]*lastfm.TrackInfo)
+	}
+
+	for i := range tracks {
+		key := strings.ToLower(tracks[i].Artist + "|" + tracks[i].Track)
+		info, ok := l.details[key]
+		if !ok {
+			var err error
+			info, err = client.Track.Info(lastfm.TrackInfoParams{
+				Artist: tracks[i].Artist,
+				Track:  tracks[i].Track,
+			})
+			if err != nil {
+				slog.Warn("Failed to get track details", "artist", tracks[i].Artist, "title", tracks[i].Track, "error", err, "source", "lastfm")
+				continue
+			}
+			l.details[key] = info
+		}
+
+		tracks[i].Duration = info.Duration.Unwrap()
+		if tracks[i].Album == "" {
+			tracks[i].Album = info.Album.Title
+		}
+		if tracks[i].AlbumMBID == "" {
+			tracks[i].AlbumMBID = info.Album.MBID
+		}
+	}
+}
+
 // Love marks tracks as loved on Last.fm
 func (l *Lastfm) Love(tracks []model.LovedTrack) error {
 	if len(tracks) == 0 {
@@ -8,6 +8,8 @@ import (
 	"log/slog"
 	"net/http"
 	"strconv"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/csmith/musiclover/model"
@@ -17,6 +19,16 @@ import (
 type ListenBrainz struct {
 	Token    string
 	Username string
+	// FetchDetails enables looking up each loved recording to find its
+	// duration, at the cost of an extra request per 50 tracks
+	FetchDetails bool
+	// HatedRating is the rating (1-5) that hated tracks are synced as. If
+	// zero, hates aren't synced.
+	HatedRating int
+
+	mu        sync.Mutex
+	durations map[string]time.Duration
+	hated     map[string]bool
 }
 
 type listenBrainzFeedbackResponse struct {
@@ -27,8 +39,34 @@ type listenBrainzFeedbackResponse struct {
 }
 
 type listenBrainzFeedback struct {
-	RecordingMBID string `json:"recording_mbid"`
-	Score         int    `json:"score"`
+	RecordingMBID string                     `json:"recording_mbid"`
+	Score         int                        `json:"score"`
+	Created       int64                      `json:"created"`
+	TrackMetadata *listenBrainzTrackMetadata `json:"track_metadata"`
+}
+
+type listenBrainzTrackMetadata struct {
+	ArtistName  string                   `json:"artist_name"`
+	TrackName   string                   `json:"track_name"`
+	ReleaseName string                   `json:"release_name"`
+	MBIDMapping *listenBrainzMBIDMapping `json:"mbid_mapping"`
+}
+
+type listenBrainzMBIDMapping struct {
+	ReleaseMBID string                     `json:"release_mbid"`
+	Artists     []listenBrainzArtistCredit `json:"artists"`
+}
+
+type listenBrainzArtistCredit struct {
+	ArtistCreditName string `json:"artist_credit_name"`
+	ArtistMBID       string `json:"artist_mbid"`
+	JoinPhrase       string `json:"join_phrase"`
+}
+
+type listenBrainzRecordingMetadata struct {
+	Recording struct {
+		Length int `json:"length"`
+	} `json:"recording"`
 }
 
 type listenBrainzRecordingFeedback struct {
@@ -40,12 +78,29 @@ type listenBrainzRecordingFeedback struct {
 func (lb *ListenBrainz) LovedTracks() ([]model.LovedTrack, error) {
 	slog.Debug("Retrieving loved tracks", "source", "listenbrainz")
 
+	tracks, err := lb.fetchFeedback(1)
+	if err != nil {
+		return nil, err
+	}
+
+	slog.Debug("Retrieved loved tracks", "count", len(tracks), "source", "listenbrainz")
+
+	if lb.FetchDetails {
+		lb.addDurations(tracks)
+	}
+
+	return tracks, nil
+}
+
+// fetchFeedback retrieves every track the user has given the feedback score
+// to, where 1 is loved and -1 is hated
+func (lb *ListenBrainz) fetchFeedback(score int) ([]model.LovedTrack, error) {
 	var allTracks []model.LovedTrack
 	offset := 0
 	const pageSize = 100
 
 	for {
-		tracks, totalCount, err := lb.fetchLovedTracksPage(offset, pageSize)
+		tracks, totalCount, err := lb.fetchFeedbackPage(score, offset, pageSize)
 		if err != nil {
 			return nil, err
 		}
@@ -58,19 +113,72 @@ func (lb *ListenBrainz) LovedTracks() ([]model.LovedTrack, error) {
 		offset += len(tracks)
 	}
 
-	slog.Debug("Retrieved loved tracks", "count", len(allTracks), "source", "listenbrainz")
 	return allTracks, nil
 }
 
-// fetchLovedTracksPage fetches a single page of loved tracks with retry logic
-func (lb *ListenBrainz) fetchLovedTracksPage(offset, count int) ([]model.LovedTrack, int, error) {
+// fetchFeedbackPage fetches a single page of tracks with the feedback score
+func (lb *ListenBrainz) fetchFeedbackPage(score, offset, count int) ([]model.LovedTrack, int, error) {
+	url := fmt.Sprintf("https://api.listenbrainz.org/1/feedback/user/%s/get-feedback?score=%d&metadata=true&offset=%d&count=%d", lb.Username, score, offset, count)
+
+	var feedbackResp listenBrainzFeedbackResponse
+	if err := lb.getJSON(url, &feedbackResp); err != nil {
+		return nil, 0, err
+	}
+
+	var tracks []model.LovedTrack
+	for _, feedback := range feedbackResp.Feedback {
+		tracks = append(tracks, feedback.toLovedTrack())
+	}
+
+	return tracks, feedbackResp.TotalCount, nil
+}
+
+// addDurations looks up the length of each recording, as it's not included in
+// the feedback metadata. Results are cached for the life of the source.
+func (lb *ListenBrainz) addDurations(tracks []model.LovedTrack) {
+	lb.mu.Lock()
+	defer lb.mu.Unlock()
+
+	if lb.durations == nil {
+		lb.durations = make(map[string]time.Duration)
+	}
+
+	var missing []string
+	for _, track := range tracks {
+		if _, ok := lb.durations[track.TrackMBID]; !ok && track.TrackMBID != "" {
+			missing = append(missing, track.TrackMBID)
+		}
+	}
+
+	const batchSize = 50
+	for start := 0; start < len(missing); start += batchSize {
+		batch := missing[start:min(start+batchSize, len(missing))]
+		url := fmt.Sprintf("https://api.listenbrainz.org/1/metadata/recording/?recording_mbids=%s", strings.Join(batch, ","))
+
+		var metadata map[string]listenBrainzRecordingMetadata
+		if err := lb.getJSON(url, &metadata); err != nil {
+			slog.Warn("Failed to get recording details", "count", len(batch), "error", err, "source", "listenbrainz")
+			continue
+		}
+
+		for _, mbid := range batch {
+			lb.durations[mbid] = time.Duration(metadata[mbid].Recording.Length) * time.Millisecond
+		}
+	}
+
+	for i := range tracks {
+		tracks[i].Duration = lb.durations[tracks[i].TrackMBID]
+	}
+}
+
+// getJSON performs a GET request against the API and decodes the response, retrying on 429
+func (lb *ListenBrainz) getJSON(url string, v any) error {
 	const maxRetries = 3
-	url := fmt.Sprintf("https://api.listenbrainz.org/1/feedback/user/%s/get-feedback?score=1&offset=%d&count=%d", lb.Username, offset, count)
 
 	for attempt := 0; attempt < maxRetries; attempt++ {
 		req, err := http.NewRequest("GET", url, nil)
 		if err != nil {
-			return nil, 0, err
+			return err
 		}
 
 		req.Header.Set("Authorization", fmt.Sprintf("Token %s", lb.Token))
@@ -78,7 +186,7 @@ func (lb *ListenBrainz) fetchLovedTracksPage(offset, count int) ([]model.LovedTr
 		client := &http.Client{}
 		resp, err := client.Do(req)
 		if err != nil {
-			return nil, 0, err
+			return err
 		}
 		defer resp.Body.Close()
 
@@ -91,26 +199,63 @@ func (lb *ListenBrainz) fetchLovedTracksPage(offset, count int) ([]model.LovedTr
 
 		if resp.StatusCode != http.StatusOK {
 			body, _ := io.ReadAll(resp.Body)
-			return nil, 0, fmt.Errorf("ListenBrainz API error: %s - %s", resp.Status, string(body))
+			return fmt.Errorf("ListenBrainz API error: %s - %s", resp.Status, string(body))
 		}
 
-		var feedbackResp listenBrainzFeedbackResponse
-		if err := json.NewDecoder(resp.Body).Decode(&feedbackResp); err != nil {
-			return nil, 0, err
+		if err := json.NewDecoder(resp.Body).Decode(v); err != nil {
+			return err
 		}
 
-		var tracks []model.LovedTrack
-		for _, feedback := range feedbackResp.Feedback {
-			tracks = append(tracks, model.LovedTrack{
-				TrackMBID: feedback.RecordingMBID,
+		time.Sleep(1 * time.Second)
+		return nil
+	}
+
+	return fmt.Errorf("ListenBrainz: max retries exceeded due to rate limiting")
+}
+
+// toLovedTrack converts feedback to a LovedTrack, including any metadata that
+// ListenBrainz has for the recording
+func (f listenBrainzFeedback) toLovedTrack() model.LovedTrack {
+	track := model.LovedTrack{
+		TrackMBID: f.RecordingMBID,
+	}
+
+	if f.Created != 0 {
+		track.LovedAt = time.Unix(f.Created, 0)
+	}
+
+	if f.TrackMetadata == nil {
+		return track
+	}
+
+	track.Track = f.TrackMetadata.TrackName
+	track.Artist = f.TrackMetadata.ArtistName
+	track.Album = f.TrackMetadata.ReleaseName
+
+	if mapping := f.TrackMetadata.MBIDMapping; mapping != nil {
+		track.AlbumMBID = mapping.ReleaseMBID
+
+		featured := false
+		for _, artist := range mapping.Artists {
+			track.Artists = append(track.Artists, model.ArtistCredit{
+				Name:     artist.ArtistCreditName,
+				MBID:     artist.ArtistMBID,
+				Featured: featured,
 			})
+
+			// Anything after a "feat." join phrase is a featured artist
+			join := strings.ToLower(artist.JoinPhrase)
+			if strings.Contains(join, "feat") || strings.Contains(join, "ft.") {
+				featured = true
+			}
 		}
 
-		time.Sleep(1 * time.Second)
-		return tracks, feedbackResp.TotalCount, nil
+		if len(track.Artists) > 0 {
+			track.ArtistMBID = track.Artists[0].MBID
+		}
 	}
 
-	return nil, 0, fmt.Errorf("ListenBrainz: max retries exceeded due to rate limiting")
+	return track
 }
 
 // Love marks tracks as loved on ListenBrainz
@@ -0,0 +1,85 @@
+package sources
+
+import (
+	"log/slog"
+
+	"github.com/csmith/musiclover/model"
+)
+
+// RatedTracks retrieves hated tracks from ListenBrainz, rated as HatedRating.
+// If HatedRating is zero, hates aren't treated as ratings so there are none.
+func (lb *ListenBrainz) RatedTracks() ([]model.LovedTrack, error) {
+	if lb.HatedRating == 0 {
+		return nil, nil
+	}
+
+	slog.Debug("Retrieving hated tracks", "source", "listenbrainz")
+
+	tracks, err := lb.fetchFeedback(-1)
+	if err != nil {
+		return nil, err
+	}
+
+	hated := make(map[string]bool)
+	for i := range tracks {
+		tracks[i].Rating = lb.HatedRating
+		if tracks[i].TrackMBID != "" {
+			hated[tracks[i].TrackMBID] = true
+		}
+	}
+
+	lb.mu.Lock()
+	lb.hated = hated
+	lb.mu.Unlock()
+
+	slog.Debug("Retrieved hated tracks", "count", len(tracks), "source", "listenbrainz")
+
+	if lb.FetchDetails {
+		lb.addDurations(tracks)
+	}
+
+	return tracks, nil
+}
+
+// Rate hates tracks on ListenBrainz that are rated as HatedRating. Any other
+// rating removes the hate from tracks that have one, and is otherwise
+// ignored, so that loves aren't changed.
+func (lb *ListenBrainz) Rate(tracks []model.LovedTrack) error {
+	if lb.HatedRating == 0 {
+		return nil
+	}
+
+	lb.mu.Lock()
+	known := lb.hated != nil
+	lb.mu.Unlock()
+
+	if !known {
+		if _, err := lb.RatedTracks(); err != nil {
+			return err
+		}
+	}
+
+	lb.mu.Lock()
+	var hate, unhate []model.LovedTrack
+	for _, track := range tracks {
+		if track.Rating == lb.HatedRating {
+			hate = append(hate, track)
+		} else if lb.hated[track.TrackMBID] {
+			unhate = append(unhate, track)
+		}
+	}
+	lb.mu.Unlock()
+
+	if err := lb.submitFeedback(hate, -1); err != nil {
+		return err
+	}
+	return lb.submitFeedback(unhate, 0)
+}
+
+// CanRate determines whether tracks can be given the rating. ListenBrainz only
+// has hates, so the only rating is HatedRating.
+func (lb *ListenBrainz) CanRate(rating int) bool {
+	return lb.HatedRating != 0 && rating == lb.HatedRating
+}
+
+var _ model.LimitedRatingSource = &ListenBrainz{}
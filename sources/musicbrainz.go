@@ -0,0 +1,461 @@
+package sources
+
+import (
+	"crypto/md5"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/csmith/musiclover/model"
+)
+
+const (
+	musicBrainzUserAgent = "musiclover/1.0 ( https://github.com/csmith/musiclover )"
+	musicBrainzClient    = "musiclover-1.0"
+
+	// musicBrainzPageSize is how many entities are requested from a collection at once
+	musicBrainzPageSize = 100
+	// musicBrainzEditSize is how many entities are added to or removed from a collection at once
+	musicBrainzEditSize = 100
+)
+
+// MusicBrainz is a source that keeps loves in MusicBrainz collections. Loved
+// tracks, albums and artists are kept in collections of recordings, releases
+// and artists, and kinds without a collection aren't synced. Collections can
+// only hold things MusicBrainz knows about, so loves without an MBID are
+// skipped. Requests are limited to one per second.
+type MusicBrainz struct {
+	// BaseURL is the address of the MusicBrainz server, e.g. https://musicbrainz.org
+	BaseURL  string
+	Username string
+	Password string
+	// RecordingCollection is the MBID of the collection of recordings to keep loved tracks in
+	RecordingCollection string
+	// ReleaseCollection is the MBID of the collection of releases to keep loved albums in
+	ReleaseCollection string
+	// ArtistCollection is the MBID of the collection of artists to keep loved artists in
+	ArtistCollection string
+
+	mu          sync.Mutex
+	lastRequest time.Time
+	challenge   map[string]string
+	nonceCount  int
+}
+
+type musicBrainzCollectionResponse struct {
+	Recordings     []musicBrainzRecording `json:"recordings"`
+	RecordingCount int                    `json:"recording-count"`
+	Releases       []musicBrainzRelease   `json:"releases"`
+	ReleaseCount   int                    `json:"release-count"`
+	Artists        []musicBrainzArtist    `json:"artists"`
+	ArtistCount    int                    `json:"artist-count"`
+}
+
+type musicBrainzRecording struct {
+	ID           string                    `json:"id"`
+	Title        string                    `json:"title"`
+	Length       int                       `json:"length"`
+	ISRCs        []string                  `json:"isrcs"`
+	ArtistCredit []musicBrainzArtistCredit `json:"artist-credit"`
+}
+
+type musicBrainzRelease struct {
+	ID           string                    `json:"id"`
+	Title        string                    `json:"title"`
+	ArtistCredit []musicBrainzArtistCredit `json:"artist-credit"`
+}
+
+type musicBrainzArtist struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+}
+
+type musicBrainzArtistCredit struct {
+	Name       string            `json:"name"`
+	JoinPhrase string            `json:"joinphrase"`
+	Artist     musicBrainzArtist `json:"artist"`
+}
+
+// Syncs determines whether the kind of love can be synced, which depends on
+// whether it has a collection
+func (m *MusicBrainz) Syncs(kind string) bool {
+	switch kind {
+	case "tracks":
+		return m.RecordingCollection != ""
+	case "albums":
+		return m.ReleaseCollection != ""
+	case "artists":
+		return m.ArtistCollection != ""
+	}
+	return false
+}
+
+// LovedTracks retrieves the recordings in the recording collection
+func (m *MusicBrainz) LovedTracks() ([]model.LovedTrack, error) {
+	if m.RecordingCollection == "" {
+		return nil, nil
+	}
+
+	var tracks []model.LovedTrack
+	err := m.browse("recording", m.RecordingCollection, "artist-credits+isrcs", func(page musicBrainzCollectionResponse) (int, int) {
+		for _, recording := range page.Recordings {
+			tracks = append(tracks, recording.toLovedTrack())
+		}
+		return len(page.Recordings), page.RecordingCount
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	slog.Debug("Retrieved loved tracks", "count", len(tracks), "source", "musicbrainz")
+	return tracks, nil
+}
+
+// Love adds recordings to the recording collection
+func (m *MusicBrainz) Love(tracks []model.LovedTrack) error {
+	return m.edit(http.MethodPut, "recordings", m.RecordingCollection, recordingMBIDs(tracks))
+}
+
+// Unlove removes recordings from the recording collection
+func (m *MusicBrainz) Unlove(tracks []model.LovedTrack) error {
+	return m.edit(http.MethodDelete, "recordings", m.RecordingCollection, recordingMBIDs(tracks))
+}
+
+// LovedAlbums retrieves the releases in the release collection
+func (m *MusicBrainz) LovedAlbums() ([]model.LovedAlbum, error) {
+	if m.ReleaseCollection == "" {
+		return nil, nil
+	}
+
+	var albums []model.LovedAlbum
+	err := m.browse("release", m.ReleaseCollection, "artist-credits", func(page musicBrainzCollectionResponse) (int, int) {
+		for _, release := range page.Releases {
+			artist, artistMBID := creditedArtist(release.ArtistCredit)
+			albums = append(albums, model.LovedAlbum{
+				ID:         release.ID,
+				Title:      release.Title,
+				Artist:     artist,
+				MBID:       release.ID,
+				ArtistMBID: artistMBID,
+			})
+		}
+		return len(page.Releases), page.ReleaseCount
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	slog.Debug("Retrieved loved albums", "count", len(albums), "source", "musicbrainz")
+	return albums, nil
+}
+
+// LoveAlbums adds releases to the release collection
+func (m *MusicBrainz) LoveAlbums(albums []model.LovedAlbum) error {
+	return m.edit(http.MethodPut, "releases", m.ReleaseCollection, releaseMBIDs(albums))
+}
+
+// UnloveAlbums removes releases from the release collection
+func (m *MusicBrainz) UnloveAlbums(albums []model.LovedAlbum) error {
+	return m.edit(http.MethodDelete, "releases", m.ReleaseCollection, releaseMBIDs(albums))
+}
+
+// LovedArtists retrieves the artists in the artist collection
+func (m *MusicBrainz) LovedArtists() ([]model.LovedArtist, error) {
+	if m.ArtistCollection == "" {
+		return nil, nil
+	}
+
+	var artists []model.LovedArtist
+	err := m.browse("artist", m.ArtistCollection, "", func(page musicBrainzCollectionResponse) (int, int) {
+		for _, artist := range page.Artists {
+			artists = append(artists, model.LovedArtist{
+				ID:   artist.ID,
+				Name: artist.Name,
+				MBID: artist.ID,
+			})
+		}
+		return len(page.Artists), page.ArtistCount
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	slog.Debug("Retrieved loved artists", "count", len(artists), "source", "musicbrainz")
+	return artists, nil
+}
+
+// LoveArtists adds artists to the artist collection
+func (m *MusicBrainz) LoveArtists(artists []model.LovedArtist) error {
+	return m.edit(http.MethodPut, "artists", m.ArtistCollection, lovedArtistMBIDs(artists))
+}
+
+// UnloveArtists removes artists from the artist collection
+func (m *MusicBrainz) UnloveArtists(artists []model.LovedArtist) error {
+	return m.edit(http.MethodDelete, "artists", m.ArtistCollection, lovedArtistMBIDs(artists))
+}
+
+// browse retrieves every page of entities in a collection. The page function
+// is given each response, and returns how many entities were in it and how
+// many there are in total.
+func (m *MusicBrainz) browse(entity, collection, inc string, page func(musicBrainzCollectionResponse) (int, int)) error {
+	for offset := 0; ; {
+		params := url.Values{
+			"collection": {collection},
+			"limit":      {fmt.Sprint(musicBrainzPageSize)},
+			"offset":     {fmt.Sprint(offset)},
+			"fmt":        {"json"},
+		}
+		if inc != "" {
+			params.Set("inc", inc)
+		}
+
+		var response musicBrainzCollectionResponse
+		if err := m.request(http.MethodGet, "/ws/2/"+entity+"?"+params.Encode(), &response); err != nil {
+			return err
+		}
+
+		count, total := page(response)
+		offset += count
+		if count == 0 || offset >= total {
+			return nil
+		}
+	}
+}
+
+// edit adds entities to a collection, or removes them from it, depending on
+// the method
+func (m *MusicBrainz) edit(method, entities, collection string, mbids []string) error {
+	if len(mbids) == 0 {
+		return nil
+	}
+
+	if collection == "" {
+		slog.Warn("No collection configured, skipping", "kind", entities, "count", len(mbids), "source", "musicbrainz")
+		return nil
+	}
+
+	for start := 0; start < len(mbids); start += musicBrainzEditSize {
+		batch := mbids[start:min(start+musicBrainzEditSize, len(mbids))]
+		path := fmt.Sprintf("/ws/2/collection/%s/%s/%s?client=%s", url.PathEscape(collection), entities, strings.Join(batch, ";"), musicBrainzClient)
+		if err := m.request(method, path, nil); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// request performs a request against the web service, honouring its rate
+// limit, and decodes the response into v if it's not nil. Requests are
+// authenticated once the server asks for it, if there's a username.
+func (m *MusicBrainz) request(method, path string, v any) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	const maxRetries = 3
+
+	for attempt := 0; attempt < maxRetries; attempt++ {
+		m.wait()
+
+		req, err := http.NewRequest(method, strings.TrimSuffix(m.BaseURL, "/")+path, nil)
+		if err != nil {
+			return err
+		}
+
+		req.Header.Set("User-Agent", musicBrainzUserAgent)
+		req.Header.Set("Accept", "application/json")
+		if m.challenge != nil {
+			req.Header.Set("Authorization", m.digestAuthorization(method, req.URL.RequestURI()))
+		}
+
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			return err
+		}
+
+		body, err := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		if err != nil {
+			return err
+		}
+
+		switch resp.StatusCode {
+		case http.StatusOK:
+			if v == nil {
+				return nil
+			}
+			return json.Unmarshal(body, v)
+		case http.StatusUnauthorized:
+			// The server's nonce may have expired, so a new challenge is always answered
+			if m.Username == "" {
+				return fmt.Errorf("MusicBrainz requires a username and password for this request")
+			}
+			m.challenge = parseDigestChallenge(resp.Header.Get("WWW-Authenticate"))
+			m.nonceCount = 0
+			if m.challenge == nil {
+				return fmt.Errorf("MusicBrainz didn't offer digest authentication")
+			}
+		case http.StatusServiceUnavailable, http.StatusTooManyRequests:
+			slog.Warn("Rate limited, retrying", "attempt", attempt+1, "source", "musicbrainz")
+			time.Sleep(time.Duration(attempt+1) * 5 * time.Second)
+		default:
+			return fmt.Errorf("MusicBrainz API error: %s - %s", resp.Status, string(body))
+		}
+	}
+
+	return fmt.Errorf("MusicBrainz: max retries exceeded")
+}
+
+// wait sleeps until the next request is allowed under the rate limit
+func (m *MusicBrainz) wait() {
+	if next := m.lastRequest.Add(time.Second); time.Now().Before(next) {
+		time.Sleep(time.Until(next))
+	}
+	m.lastRequest = time.Now()
+}
+
+// digestAuthorization answers the server's digest challenge for a request
+func (m *MusicBrainz) digestAuthorization(method, uri string) string {
+	m.nonceCount++
+
+	realm, nonce := m.challenge["realm"], m.challenge["nonce"]
+	ha1 := md5Hex(m.Username + ":" + realm + ":" + m.Password)
+	ha2 := md5Hex(method + ":" + uri)
+
+	header := fmt.Sprintf(`Digest username="%s", realm="%s", nonce="%s", uri="%s"`, m.Username, realm, nonce, uri)
+	if strings.Contains(m.challenge["qop"], "auth") {
+		cnonce := make([]byte, 8)
+		_, _ = rand.Read(cnonce)
+		nc := fmt.Sprintf("%08x", m.nonceCount)
+		response := md5Hex(ha1 + ":" + nonce + ":" + nc + ":" + hex.EncodeToString(cnonce) + ":auth:" + ha2)
+		header += fmt.Sprintf(`, qop=auth, nc=%s, cnonce="%s", response="%s"`, nc, hex.EncodeToString(cnonce), response)
+	} else {
+		header += fmt.Sprintf(`, response="%s"`, md5Hex(ha1+":"+nonce+":"+ha2))
+	}
+
+	if opaque, ok := m.challenge["opaque"]; ok {
+		header += fmt.Sprintf(`, opaque="%s"`, opaque)
+	}
+	return header
+}
+
+// parseDigestChallenge reads the parameters of a digest WWW-Authenticate
+// header, returning nil if it isn't one
+func parseDigestChallenge(header string) map[string]string {
+	rest, ok := strings.CutPrefix(header, "Digest ")
+	if !ok {
+		return nil
+	}
+
+	params := make(map[string]string)
+	for rest != "" {
+		var key, value string
+		key, rest, _ = strings.Cut(strings.TrimLeft(rest, ", "), "=")
+		if quoted, ok := strings.CutPrefix(rest, `"`); ok {
+			value, rest, _ = strings.Cut(quoted, `"`)
+		} else {
+			value, rest, _ = strings.Cut(rest, ",")
+		}
+		params[strings.ToLower(strings.TrimSpace(key))] = value
+	}
+	return params
+}
+
+func md5Hex(s string) string {
+	sum := md5.Sum([]byte(s))
+	return hex.EncodeToString(sum[:])
+}
+
+// toLovedTrack converts a recording into a LovedTrack
+func (r musicBrainzRecording) toLovedTrack() model.LovedTrack {
+	track := model.LovedTrack{
+		ID:        r.ID,
+		TrackMBID: r.ID,
+		Track:     r.Title,
+		ISRCs:     r.ISRCs,
+		Duration:  time.Duration(r.Length) * time.Millisecond,
+	}
+
+	featured := false
+	for _, credit := range r.ArtistCredit {
+		track.Artists = append(track.Artists, model.ArtistCredit{
+			Name:     credit.Name,
+			MBID:     credit.Artist.ID,
+			Featured: featured,
+		})
+
+		// Anything after a "feat." join phrase is a featured artist
+		join := strings.ToLower(credit.JoinPhrase)
+		if strings.Contains(join, "feat") || strings.Contains(join, "ft.") {
+			featured = true
+		}
+	}
+
+	track.Artist, track.ArtistMBID = creditedArtist(r.ArtistCredit)
+	return track
+}
+
+// creditedArtist returns the full name of everyone credited, and the MBID of
+// the first artist
+func creditedArtist(credits []musicBrainzArtistCredit) (string, string) {
+	var name strings.Builder
+	for _, credit := range credits {
+		name.WriteString(credit.Name + credit.JoinPhrase)
+	}
+
+	if len(credits) == 0 {
+		return "", ""
+	}
+	return name.String(), credits[0].Artist.ID
+}
+
+// recordingMBIDs returns the recording MBIDs of the tracks, skipping any without one
+func recordingMBIDs(tracks []model.LovedTrack) []string {
+	var mbids []string
+	for _, track := range tracks {
+		if track.TrackMBID == "" {
+			slog.Warn("Skipping track without MBID", "artist", track.Artist, "title", track.Track, "source", "musicbrainz")
+			continue
+		}
+		mbids = append(mbids, track.TrackMBID)
+	}
+	return mbids
+}
+
+// releaseMBIDs returns the release MBIDs of the albums, skipping any without one
+func releaseMBIDs(albums []model.LovedAlbum) []string {
+	var mbids []string
+	for _, album := range albums {
+		if album.MBID == "" {
+			slog.Warn("Skipping album without MBID", "artist", album.Artist, "album", album.Title, "source", "musicbrainz")
+			continue
+		}
+		mbids = append(mbids, album.MBID)
+	}
+	return mbids
+}
+
+// lovedArtistMBIDs returns the MBIDs of the artists, skipping any without one
+func lovedArtistMBIDs(artists []model.LovedArtist) []string {
+	var mbids []string
+	for _, artist := range artists {
+		if artist.MBID == "" {
+			slog.Warn("Skipping artist without MBID", "artist", artist.Name, "source", "musicbrainz")
+			continue
+		}
+		mbids = append(mbids, artist.MBID)
+	}
+	return mbids
+}
+
+var _ model.Source = &MusicBrainz{}
+var _ model.KindSource = &MusicBrainz{}
+var _ model.AlbumSource = &MusicBrainz{}
+var _ model.ArtistSource = &MusicBrainz{}
@@ -1,48 +1,170 @@
 package sources
 
 import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"io"
 	"log/slog"
 	"net/http"
+	"net/url"
+	"slices"
 	"strconv"
+	"strings"
 	"sync"
+	"time"
 
 	"github.com/csmith/musiclover/matcher"
 	"github.com/csmith/musiclover/model"
 	"github.com/supersonic-app/go-subsonic/subsonic"
 )
 
+const (
+	// searchBatchSize is how many songs are requested at a time when
+	// retrieving the whole library
+	searchBatchSize = 500
+	// lookupSongCount is how many songs are requested when searching for a
+	// single track
+	lookupSongCount = 50
+	// lookupRequests is roughly how many requests it takes to look up a
+	// single track
+	lookupRequests = 2
+	// defaultLookupLimit is the most tracks that will be looked up
+	// individually if the size of the library isn't known
+	defaultLookupLimit = 100
+	// mbidProbeAlbums is how many albums are looked through for a song with
+	// an MBID, when checking whether the server can search by MBID
+	mbidProbeAlbums = 5
+)
+
 // Subsonic is a source that retrieves loved tracks from a Subsonic server
 type Subsonic struct {
-	BaseURL    string
-	Username   string
-	Password   string
+	BaseURL  string
+	Username string
+	Password string
+	// APIKey authenticates with an OpenSubsonic API key instead of a username and password
+	APIKey     string
 	ClientName string
+	// MatchOptions are used when finding songs in the library to love or unlove
+	MatchOptions []matcher.Option
+	// Pairings remembers which songs in the library were previously chosen for each track
+	Pairings *matcher.Pairings
+	// Playlist is the name of a playlist to use for loved tracks instead of
+	// stars. It's created the first time a track is loved.
+	Playlist string
+	// StarAllCopies stars every copy of a track in the library, rather than
+	// just the preferred one. Copies are decided by the duplicates score in
+	// MatchOptions (see matcher.WithDuplicates).
+	StarAllCopies bool
+	// MusicFolders limits the library to the music folders with these names or IDs. If empty, every folder is used.
+	MusicFolders []string
+	// StateDir is where the index of the library is cached between runs. If empty, it's only cached in memory.
+	StateDir string
+	// RebuildInterval is how often the index of the library is rebuilt from scratch, rather than
+	// just checking for new albums. If zero, it's never rebuilt.
+	RebuildInterval time.Duration
+
+	mu             sync.Mutex
+	client         *subsonic.Client
+	user           string
+	openSubsonic   bool
+	extensions     map[string]bool
+	folderIDs      []string
+	library        *subsonicLibrary
+	checked        time.Time
+	songsRefreshed time.Time
+	libraryDirty   bool
 
-	mu          sync.Mutex
-	client      *subsonic.Client
-	artistMBIDs map[string]string
-	albumMBIDs  map[string]string
-	allSongs    []*subsonic.Child
+	playlistLovedAt map[string]time.Time
+
+	mbidSearchOnce sync.Once
+	mbidSearch     bool
+
+	extrasMu   sync.Mutex
+	songExtras map[string]subsonicSongExtras
 }
 
-// LovedTracks retrieves starred tracks from the Subsonic server
-func (s *Subsonic) LovedTracks() ([]model.LovedTrack, error) {
-	client, err := s.getClient()
-	if err != nil {
-		return nil, err
+// subsonicSongExtras holds song fields from OpenSubsonic extensions that
+// aren't supported by the client library
+type subsonicSongExtras struct {
+	ID           string                `xml:"id,attr" json:"-"`
+	ISRC         []string              `xml:"isrc" json:"isrc,omitempty"`
+	Artists      []subsonicArtistExtra `xml:"artists" json:"artists,omitempty"`
+	AlbumArtists []subsonicArtistExtra `xml:"albumArtists" json:"album_artists,omitempty"`
+}
+
+// subsonicArtistExtra holds the fields of an OpenSubsonic artist reference
+// that aren't supported by the client library
+type subsonicArtistExtra struct {
+	ID            string `xml:"id,attr" json:"id"`
+	MusicBrainzID string `xml:"musicBrainzId,attr" json:"mbid,omitempty"`
+}
+
+// subsonicAlbum is an album from getAlbumList2. The client library doesn't
+// support OpenSubsonic's album MBIDs, so lists of albums are parsed here.
+type subsonicAlbum struct {
+	ID            string `xml:"id,attr"`
+	MusicBrainzID string `xml:"musicBrainzId,attr"`
+	SongCount     int    `xml:"songCount,attr"`
+	Created       string `xml:"created,attr"`
+	Changed       string `xml:"changed,attr"`
+}
+
+// version identifies the state of the album, using when it was last changed if
+// the server says, or when it was added otherwise. Servers that rescan an
+// album after its files change give it a new version, but not all do.
+func (a subsonicAlbum) version() string {
+	if a.Changed != "" {
+		return a.Changed
 	}
+	return a.Created
+}
 
-	slog.Debug("Retrieving starred tracks", "source", "subsonic")
+// apiKeyTransport authenticates requests with an OpenSubsonic API key,
+// replacing the user and password parameters added by the client library
+type apiKeyTransport struct {
+	key  string
+	base http.RoundTripper
+}
 
-	starred, err := client.GetStarred2(nil)
+func (t *apiKeyTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	req = req.Clone(req.Context())
+	query := req.URL.Query()
+	for _, param := range []string{"u", "p", "t", "s"} {
+		query.Del(param)
+	}
+	query.Set("apiKey", t.key)
+	req.URL.RawQuery = query.Encode()
+	return t.base.RoundTrip(req)
+}
+
+// LovedTracks retrieves starred tracks from the Subsonic server, or the
+// tracks in the playlist if one is configured
+func (s *Subsonic) LovedTracks() ([]model.LovedTrack, error) {
+	client, err := s.getClient()
 	if err != nil {
 		return nil, err
 	}
 
-	slog.Debug("Retrieved starred tracks", "count", len(starred.Song), "source", "subsonic")
+	var songs []*subsonic.Child
+	if s.Playlist != "" {
+		playlist, err := s.getPlaylist(client, false)
+		if err != nil {
+			return nil, err
+		}
+		if playlist != nil {
+			songs = playlist.Entry
+		}
+	} else {
+		starred, err := s.getStarred(client)
+		if err != nil {
+			return nil, err
+		}
+		songs = starred.Song
+	}
 
 	// Get artist MBIDs
-	artistMBIDs, err := s.getArtistMBIDs(client)
+	artistMBIDs, err := s.artistMBIDsFor(client, songs)
 	if err != nil {
 		return nil, err
 	}
@@ -54,13 +176,69 @@ func (s *Subsonic) LovedTracks() ([]model.LovedTrack, error) {
 	}
 
 	// Convert to LovedTrack format
-	tracks := s.childToLovedTrack(starred.Song, artistMBIDs, albumMBIDs)
+	tracks := s.childToLovedTrack(songs, artistMBIDs, albumMBIDs)
+
+	if s.Playlist != "" {
+		// Playlist entries aren't starred, so are only known to have been
+		// loved when they were added to the playlist by musiclover
+		dates, err := s.playlistDates()
+		if err != nil {
+			return nil, err
+		}
+		for i := range tracks {
+			tracks[i].LovedAt = dates[tracks[i].ID]
+		}
+	}
 	return tracks, nil
 }
 
-// Love stars tracks on the Subsonic server
+// getStarred retrieves the songs, albums and artists starred in each of the
+// selected music folders
+func (s *Subsonic) getStarred(client *subsonic.Client) (*subsonic.Starred2, error) {
+	slog.Debug("Retrieving starred items", "source", "subsonic")
+
+	starred := &subsonic.Starred2{}
+	seenAlbums := make(map[string]bool)
+	seenArtists := make(map[string]bool)
+	for _, folder := range s.selectedFolders() {
+		resp, err := s.get(client, "getStarred2", inFolder(map[string]string{}, folder))
+		if err != nil {
+			return nil, err
+		}
+
+		if resp.Starred2 == nil {
+			continue
+		}
+
+		starred.Song = append(starred.Song, resp.Starred2.Song...)
+
+		// Artists and albums can span music folders, so may be listed more than once
+		for _, album := range resp.Starred2.Album {
+			if !seenAlbums[album.ID] {
+				seenAlbums[album.ID] = true
+				starred.Album = append(starred.Album, album)
+			}
+		}
+		for _, artist := range resp.Starred2.Artist {
+			if !seenArtists[artist.ID] {
+				seenArtists[artist.ID] = true
+				starred.Artist = append(starred.Artist, artist)
+			}
+		}
+	}
+
+	slog.Debug("Retrieved starred items", "songs", len(starred.Song), "albums", len(starred.Album), "artists", len(starred.Artist), "source", "subsonic")
+	return starred, nil
+}
+
+// Love stars tracks on the Subsonic server, or adds them to the playlist if
+// one is configured
 func (s *Subsonic) Love(tracks []model.LovedTrack) error {
-	songs, err := s.findSongs(tracks)
+	if s.Playlist != "" {
+		return s.lovePlaylist(tracks)
+	}
+
+	songs, err := s.findSongs(tracks, s.StarAllCopies)
 	if err != nil {
 		return err
 	}
@@ -84,9 +262,11 @@ func (s *Subsonic) Love(tracks []model.LovedTrack) error {
 	})
 }
 
-// Unlove unstars tracks on the Subsonic server
+// Unlove unstars tracks on the Subsonic server, or removes them from the
+// playlist if one is configured. Every copy of each track is removed, so
+// that none of them are still seen as loved.
 func (s *Subsonic) Unlove(tracks []model.LovedTrack) error {
-	songs, err := s.findSongs(tracks)
+	songs, err := s.findSongs(tracks, true)
 	if err != nil {
 		return err
 	}
@@ -100,6 +280,10 @@ func (s *Subsonic) Unlove(tracks []model.LovedTrack) error {
 		return err
 	}
 
+	if s.Playlist != "" {
+		return s.removeFromPlaylist(client, songs)
+	}
+
 	var songIDs []string
 	for _, song := range songs {
 		songIDs = append(songIDs, song.ID)
@@ -126,131 +310,363 @@ func (s *Subsonic) getClient() (*subsonic.Client, error) {
 		ClientName: s.ClientName,
 	}
 
-	if s.Password != "" {
+	if s.APIKey != "" {
+		client.Client = &http.Client{Transport: &apiKeyTransport{key: s.APIKey, base: http.DefaultTransport}}
+	} else if s.Password != "" {
 		if err := client.Authenticate(s.Password); err != nil {
 			return nil, err
 		}
 	}
 
+	s.detectOpenSubsonic(client)
+
+	if s.APIKey != "" {
+		if !s.extensions["apiKeyAuthentication"] {
+			return nil, fmt.Errorf("server doesn't support API key authentication")
+		}
+		user, err := s.getTokenUser(client)
+		if err != nil {
+			return nil, err
+		}
+		s.user = user
+	} else {
+		s.user = s.Username
+	}
+
+	if err := s.resolveFolders(client); err != nil {
+		return nil, err
+	}
+
 	s.client = client
 	return s.client, nil
 }
 
-// getArtistMBIDs retrieves all artist MBIDs from the Subsonic server
-func (s *Subsonic) getArtistMBIDs(client *subsonic.Client) (map[string]string, error) {
-	s.mu.Lock()
-	defer s.mu.Unlock()
+// detectOpenSubsonic checks whether the server supports OpenSubsonic, and
+// which extensions it offers. Servers that don't are used as plain Subsonic.
+func (s *Subsonic) detectOpenSubsonic(client *subsonic.Client) {
+	s.extensions = make(map[string]bool)
 
-	if s.artistMBIDs != nil {
-		return s.artistMBIDs, nil
+	resp, err := s.get(client, "getOpenSubsonicExtensions", nil)
+	if err != nil || !resp.OpenSubsonic {
+		slog.Debug("Server doesn't support OpenSubsonic", "error", err, "source", "subsonic")
+		return
 	}
 
-	slog.Debug("Retrieving artist MBIDs", "source", "subsonic")
+	s.openSubsonic = true
+	for _, extension := range resp.OpenSubsonicExtensions {
+		s.extensions[extension.Name] = true
+	}
+	slog.Debug("Server supports OpenSubsonic", "extensions", len(s.extensions), "source", "subsonic")
+}
+
+// get performs a request against the Subsonic API and returns the parsed
+// response. Any OpenSubsonic song fields that the client library doesn't
+// support are recorded, and can be retrieved with extrasFor.
+func (s *Subsonic) get(client *subsonic.Client, endpoint string, params map[string]string) (*subsonic.Response, error) {
+	parsed, _, err := s.getBody(client, endpoint, params)
+	return parsed, err
+}
+
+// getBody performs a request in the same way as get, also returning the
+// response body so that fields the client library doesn't support can be
+// read from it
+func (s *Subsonic) getBody(client *subsonic.Client, endpoint string, params map[string]string) (*subsonic.Response, []byte, error) {
+	values := url.Values{}
+	for k, v := range params {
+		values.Set(k, v)
+	}
 
-	artists, err := client.GetArtists(nil)
+	resp, err := client.Request(http.MethodGet, endpoint, values)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	parsed := &subsonic.Response{}
+	if err := xml.Unmarshal(body, parsed); err != nil {
+		return nil, nil, err
+	}
+
+	if parsed.Error != nil {
+		return nil, nil, fmt.Errorf("subsonic error #%d: %s", parsed.Error.Code, parsed.Error.Message)
+	}
+
+	if err := s.recordSongExtras(body); err != nil {
+		return nil, nil, err
+	}
+
+	return parsed, body, nil
+}
+
+// getTokenUser checks the API key is valid, returning the name of the user
+// it belongs to
+func (s *Subsonic) getTokenUser(client *subsonic.Client) (string, error) {
+	_, body, err := s.getBody(client, "tokenInfo", nil)
+	if err != nil {
+		return "", err
+	}
+
+	var info struct {
+		TokenInfo struct {
+			Username string `xml:"username,attr"`
+		} `xml:"tokenInfo"`
+	}
+	if err := xml.Unmarshal(body, &info); err != nil {
+		return "", err
+	}
+
+	if info.TokenInfo.Username == "" {
+		return "", fmt.Errorf("server didn't say which user the API key belongs to")
+	}
+	return info.TokenInfo.Username, nil
+}
+
+// getAlbumList2 retrieves a page of albums organised by tags, so that their
+// IDs are the same as songs' album IDs. Albums are taken from the given music
+// folder, or the whole library if it's empty.
+func (s *Subsonic) getAlbumList2(client *subsonic.Client, listType string, size, offset int, folder string) ([]subsonicAlbum, error) {
+	_, body, err := s.getBody(client, "getAlbumList2", inFolder(map[string]string{
+		"type":   listType,
+		"size":   strconv.Itoa(size),
+		"offset": strconv.Itoa(offset),
+	}, folder))
 	if err != nil {
 		return nil, err
 	}
 
-	mbids := make(map[string]string)
-	for _, index := range artists.Index {
-		for _, artist := range index.Artist {
-			if artist.MusicBrainzId != "" {
-				mbids[artist.ID] = artist.MusicBrainzId
+	var list struct {
+		Albums []subsonicAlbum `xml:"albumList2>album"`
+	}
+	if err := xml.Unmarshal(body, &list); err != nil {
+		return nil, err
+	}
+	return list.Albums, nil
+}
+
+// recordSongExtras finds all songs in a response body and stores their extra fields
+func (s *Subsonic) recordSongExtras(body []byte) error {
+	s.extrasMu.Lock()
+	defer s.extrasMu.Unlock()
+
+	if s.songExtras == nil {
+		s.songExtras = make(map[string]subsonicSongExtras)
+	}
+
+	decoder := xml.NewDecoder(bytes.NewReader(body))
+	for {
+		token, err := decoder.Token()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		start, ok := token.(xml.StartElement)
+		if !ok || (start.Name.Local != "song" && start.Name.Local != "entry" && start.Name.Local != "child") {
+			continue
+		}
+
+		var extras subsonicSongExtras
+		if err := decoder.DecodeElement(&extras, &start); err != nil {
+			return err
+		}
+
+		if len(extras.ISRC) > 0 || len(extras.Artists) > 0 || len(extras.AlbumArtists) > 0 {
+			s.songExtras[extras.ID] = extras
+		}
+	}
+}
+
+// extrasFor returns any extra fields recorded for the given song
+func (s *Subsonic) extrasFor(id string) subsonicSongExtras {
+	s.extrasMu.Lock()
+	defer s.extrasMu.Unlock()
+	return s.songExtras[id]
+}
+
+// artistMBID returns the MBID the server gave for the song's artist or album
+// artist with the given ID, if any
+func (e subsonicSongExtras) artistMBID(id string) string {
+	for _, artists := range [][]subsonicArtistExtra{e.Artists, e.AlbumArtists} {
+		for _, artist := range artists {
+			if artist.ID == id && artist.MusicBrainzID != "" {
+				return artist.MusicBrainzID
 			}
 		}
 	}
+	return ""
+}
 
-	slog.Debug("Retrieved artist MBIDs", "count", len(mbids), "source", "subsonic")
-	s.artistMBIDs = mbids
-	return mbids, nil
+// artistMBIDsFor returns artist MBIDs for the given songs. OpenSubsonic
+// servers include them with each song, so the whole library's artists are
+// only retrieved if some are missing.
+func (s *Subsonic) artistMBIDsFor(client *subsonic.Client, songs []*subsonic.Child) (map[string]string, error) {
+	if s.openSubsonic && !slices.ContainsFunc(songs, s.missingArtistMBIDs) {
+		return nil, nil
+	}
+	return s.getArtistMBIDs(client)
 }
 
-// getAlbumMBIDs retrieves all album MBIDs from the Subsonic server
-func (s *Subsonic) getAlbumMBIDs(client *subsonic.Client) (map[string]string, error) {
+// missingArtistMBIDs determines whether the server didn't include an MBID for
+// any of the song's artists
+func (s *Subsonic) missingArtistMBIDs(song *subsonic.Child) bool {
+	if len(song.Artists) == 0 {
+		return true
+	}
+
+	extras := s.extrasFor(song.ID)
+	for _, artist := range song.Artists {
+		if extras.artistMBID(artist.ID) == "" {
+			return true
+		}
+	}
+	return false
+}
+
+// getArtistMBIDs retrieves all artist MBIDs from the Subsonic server
+func (s *Subsonic) getArtistMBIDs(client *subsonic.Client) (map[string]string, error) {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
-	if s.albumMBIDs != nil {
-		return s.albumMBIDs, nil
+	library, err := s.libraryIndex(client)
+	if err != nil {
+		return nil, err
 	}
 
-	slog.Debug("Retrieving album MBIDs", "source", "subsonic")
+	if library.ArtistMBIDs != nil {
+		return library.ArtistMBIDs, nil
+	}
 
-	mbids := make(map[string]string)
-	offset := 0
-	const batchSize = 500
+	slog.Debug("Retrieving artist MBIDs", "source", "subsonic")
 
-	for {
-		albums, err := client.GetAlbumList("alphabeticalByName", map[string]string{
-			"size":   strconv.Itoa(batchSize),
-			"offset": strconv.Itoa(offset),
-		})
+	mbids := make(map[string]string)
+	for _, folder := range s.selectedFolders() {
+		artists, err := client.GetArtists(inFolder(map[string]string{}, folder))
 		if err != nil {
 			return nil, err
 		}
 
-		if len(albums) == 0 {
-			break
-		}
-
-		for _, album := range albums {
-			if album.MusicBrainzID != "" {
-				mbids[album.ID] = album.MusicBrainzID
+		for _, index := range artists.Index {
+			for _, artist := range index.Artist {
+				if artist.MusicBrainzId != "" {
+					mbids[artist.ID] = artist.MusicBrainzId
+				}
 			}
 		}
+	}
 
-		if len(albums) < batchSize {
-			break
-		}
-		offset += batchSize
+	slog.Debug("Retrieved artist MBIDs", "count", len(mbids), "source", "subsonic")
+	library.ArtistMBIDs = mbids
+	s.libraryDirty = true
+	return mbids, s.saveLibrary()
+}
+
+// getAlbumMBIDs retrieves all album MBIDs from the Subsonic server, keyed by
+// the albums' tag-based IDs. Every album is included, with an empty MBID if
+// the server doesn't know it.
+func (s *Subsonic) getAlbumMBIDs(client *subsonic.Client) (map[string]string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	library, err := s.libraryIndex(client)
+	if err != nil {
+		return nil, err
+	}
+
+	if library.AlbumMBIDs != nil {
+		return library.AlbumMBIDs, nil
+	}
+
+	slog.Debug("Retrieving album MBIDs", "source", "subsonic")
+
+	albums, err := s.listAlbums(client)
+	if err != nil {
+		return nil, err
+	}
+
+	mbids := make(map[string]string)
+	versions := make(map[string]string)
+	for _, album := range albums {
+		mbids[album.ID] = album.MusicBrainzID
+		versions[album.ID] = album.version()
 	}
 
 	slog.Debug("Retrieved album MBIDs", "count", len(mbids), "source", "subsonic")
-	s.albumMBIDs = mbids
-	return mbids, nil
+	library.AlbumMBIDs = mbids
+	library.AlbumVersions = versions
+	s.libraryDirty = true
+	return mbids, s.saveLibrary()
 }
 
-// getAllSongs retrieves all songs from the Subsonic server
+// getAllSongs retrieves all songs from the Subsonic server, using the library
+// index if they've already been retrieved
 func (s *Subsonic) getAllSongs(client *subsonic.Client) ([]*subsonic.Child, error) {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
-	if s.allSongs != nil {
-		return s.allSongs, nil
+	library, err := s.libraryIndex(client)
+	if err != nil {
+		return nil, err
+	}
+
+	if library.Songs != nil {
+		return library.Songs, nil
 	}
 
+	allSongs, err := s.fetchAllSongs(client)
+	if err != nil {
+		return nil, err
+	}
+
+	library.Songs = allSongs
+	s.libraryDirty = true
+	return allSongs, s.saveLibrary()
+}
+
+// fetchAllSongs retrieves all songs from the Subsonic server, bypassing the
+// library index
+func (s *Subsonic) fetchAllSongs(client *subsonic.Client) ([]*subsonic.Child, error) {
 	slog.Debug("Retrieving all songs", "source", "subsonic")
 
 	var allSongs []*subsonic.Child
-	offset := 0
-	const batchSize = 500
+	for _, folder := range s.selectedFolders() {
+		for offset := 0; ; offset += searchBatchSize {
+			songs, err := s.search(client, "", searchBatchSize, offset, folder)
+			if err != nil {
+				return nil, err
+			}
 
-	for {
-		results, err := client.Search3("", map[string]string{
-			"songCount":   strconv.Itoa(batchSize),
-			"songOffset":  strconv.Itoa(offset),
-			"artistCount": "0",
-			"albumCount":  "0",
-		})
-		if err != nil {
-			return nil, err
-		}
+			allSongs = append(allSongs, songs...)
 
-		if len(results.Song) == 0 {
-			break
+			if len(songs) < searchBatchSize {
+				break
+			}
 		}
+	}
 
-		allSongs = append(allSongs, results.Song...)
+	if expected := s.libraryCount(client); incomplete(len(allSongs), expected) {
+		slog.Info("Searching didn't return the whole library, browsing it instead", "found", len(allSongs), "expected", expected, "source", "subsonic")
 
-		if len(results.Song) < batchSize {
-			break
+		walked, err := s.walkLibrary(client)
+		if err != nil {
+			return nil, err
+		}
+
+		if len(walked) > len(allSongs) {
+			allSongs = walked
 		}
-		offset += batchSize
 	}
 
 	slog.Debug("Retrieved all songs", "count", len(allSongs), "source", "subsonic")
-	s.allSongs = allSongs
+	if allSongs == nil {
+		allSongs = []*subsonic.Child{}
+	}
 	return allSongs, nil
 }
 
@@ -258,31 +674,220 @@ func (s *Subsonic) getAllSongs(client *subsonic.Client) ([]*subsonic.Child, erro
 func (s *Subsonic) childToLovedTrack(songs []*subsonic.Child, artistMBIDs, albumMBIDs map[string]string) []model.LovedTrack {
 	tracks := make([]model.LovedTrack, 0, len(songs))
 	for _, song := range songs {
+		extras := s.extrasFor(song.ID)
+
+		// OpenSubsonic's display artist includes everyone credited, e.g. "A feat. B"
+		artist := song.Artist
+		if song.DisplayArtist != "" {
+			artist = song.DisplayArtist
+		}
+
+		artistMBID := extras.artistMBID(song.ArtistID)
+		if artistMBID == "" {
+			artistMBID = artistMBIDs[song.ArtistID]
+		}
+
 		tracks = append(tracks, model.LovedTrack{
+			ID:         song.ID,
 			Track:      song.Title,
-			Artist:     song.Artist,
-			ArtistMBID: artistMBIDs[song.ArtistID],
+			Artist:     artist,
+			ArtistMBID: artistMBID,
 			Album:      song.Album,
 			AlbumMBID:  albumMBIDs[song.AlbumID],
 			TrackMBID:  song.MusicBrainzID,
+			ISRCs:      extras.ISRC,
+			Duration:   time.Duration(song.Duration) * time.Second,
+			Artists:    artistCredits(song, artist, extras, artistMBIDs),
+			Bitrate:    song.BitRate,
+			LovedAt:    song.Starred,
+			Rating:     song.UserRating,
 		})
 	}
 	return tracks
 }
 
-// findSongs searches for songs by metadata and returns matching Child records
-func (s *Subsonic) findSongs(tracks []model.LovedTrack) ([]*subsonic.Child, error) {
+// artistCredits builds structured artist credits for a song, using the
+// OpenSubsonic artists list where the server provides it, and falling back to
+// nothing otherwise
+func artistCredits(song *subsonic.Child, name string, extras subsonicSongExtras, artistMBIDs map[string]string) []model.ArtistCredit {
+	mbidFor := func(id string) string {
+		if mbid := extras.artistMBID(id); mbid != "" {
+			return mbid
+		}
+		return artistMBIDs[id]
+	}
+
+	// Without separate credits, the name can't be reliably split up
+	if len(song.Artists) == 0 {
+		return nil
+	}
+
+	parsed := model.ParseArtistCredits(name)
+	featured := make(map[string]bool)
+	for _, credit := range parsed {
+		if credit.Featured {
+			featured[strings.ToLower(credit.Name)] = true
+		}
+	}
+
+	credits := make([]model.ArtistCredit, 0, len(song.Artists))
+	for _, artist := range song.Artists {
+		credits = append(credits, model.ArtistCredit{
+			Name:     artist.Name,
+			MBID:     mbidFor(artist.ID),
+			Featured: featured[strings.ToLower(artist.Name)],
+		})
+	}
+	return credits
+}
+
+// findSongs searches for songs by metadata and returns matching Child records,
+// including any other copies of them if allCopies is set
+func (s *Subsonic) findSongs(tracks []model.LovedTrack, allCopies bool) ([]*subsonic.Child, error) {
+	found, err := s.findSongsEach(tracks, allCopies)
+	if err != nil {
+		return nil, err
+	}
+	return slices.Concat(found...), nil
+}
+
+// findSongsEach searches for the songs matching each track, in the same
+// order as the tracks. Small numbers of tracks are looked up individually;
+// larger ones are found by retrieving the whole library, which is cheaper
+// than searching for each.
+func (s *Subsonic) findSongsEach(tracks []model.LovedTrack, allCopies bool) ([][]*subsonic.Child, error) {
+	if len(tracks) == 0 {
+		return nil, nil
+	}
+
 	client, err := s.getClient()
 	if err != nil {
 		return nil, err
 	}
 
+	opts := append(slices.Clone(s.MatchOptions), matcher.WithPairings(s.Pairings, s.pairingNamespace()))
+	scan, err := s.shouldScanLibrary(client, len(tracks))
+	if err != nil {
+		return nil, err
+	}
+
+	if scan {
+		return s.findSongsInLibrary(client, tracks, opts, allCopies)
+	}
+
+	songs := make([][]*subsonic.Child, 0, len(tracks))
+	for _, track := range tracks {
+		found, err := s.lookupSong(client, track, opts, allCopies)
+		if err != nil {
+			return nil, err
+		}
+		songs = append(songs, found)
+	}
+	return songs, nil
+}
+
+// shouldScanLibrary decides whether it's cheaper to retrieve the whole
+// library than to look up the given number of tracks individually
+func (s *Subsonic) shouldScanLibrary(client *subsonic.Client, count int) (bool, error) {
+	s.mu.Lock()
+	library, err := s.libraryIndex(client)
+	cached := err == nil && library.Songs != nil
+	s.mu.Unlock()
+
+	if err != nil {
+		return false, err
+	}
+
+	if cached {
+		return true, nil
+	}
+
+	if size := s.libraryCount(client); size > 0 {
+		return count*lookupRequests > size/searchBatchSize, nil
+	}
+	return count > defaultLookupLimit, nil
+}
+
+// findSongsInLibrary finds songs by matching against every song in the library
+func (s *Subsonic) findSongsInLibrary(client *subsonic.Client, tracks []model.LovedTrack, opts []matcher.Option, allCopies bool) ([][]*subsonic.Child, error) {
 	allSongs, err := s.getAllSongs(client)
 	if err != nil {
 		return nil, err
 	}
 
-	artistMBIDs, err := s.getArtistMBIDs(client)
+	candidates, err := s.candidates(client, allSongs)
+	if err != nil {
+		return nil, err
+	}
+
+	songs := make([][]*subsonic.Child, 0, len(tracks))
+	for i, result := range matcher.SearchEach(candidates, tracks, opts...) {
+		songs = append(songs, chosenSongs(allSongs, candidates, tracks[i], result, opts, allCopies))
+	}
+	return songs, nil
+}
+
+// lookupSong searches the library for a single track, trying progressively
+// broader queries until one of them turns up a match
+func (s *Subsonic) lookupSong(client *subsonic.Client, track model.LovedTrack, opts []matcher.Option, allCopies bool) ([]*subsonic.Child, error) {
+	var found []*subsonic.Child
+	seen := make(map[string]bool)
+	add := func(songs []*subsonic.Child) {
+		for _, song := range songs {
+			if !seen[song.ID] {
+				seen[song.ID] = true
+				found = append(found, song)
+			}
+		}
+	}
+
+	// A previously paired song might not turn up in searches, and would be
+	// forgotten if it wasn't one of the candidates
+	if identity, ok := s.Pairings.Lookup(s.pairingNamespace(), track.Identity()); ok {
+		if id, ok := strings.CutPrefix(identity, "id:"); ok {
+			if song, err := client.GetSong(id); err == nil && song != nil {
+				add([]*subsonic.Child{song})
+			}
+		}
+	}
+
+	var candidates []model.LovedTrack
+	result := matcher.Result{Index: -1}
+	queries := searchQueries(track, track.TrackMBID != "" && s.searchesMBIDs(client))
+	for {
+		if len(found) > 0 {
+			var err error
+			candidates, err = s.candidates(client, found)
+			if err != nil {
+				return nil, err
+			}
+
+			result = matcher.Search(candidates, track, opts...)
+			if result.Index != -1 || len(result.Ambiguous) > 0 {
+				break
+			}
+		}
+
+		if len(queries) == 0 {
+			break
+		}
+
+		for _, folder := range s.selectedFolders() {
+			songs, err := s.search(client, queries[0], lookupSongCount, 0, folder)
+			if err != nil {
+				return nil, err
+			}
+			add(songs)
+		}
+		queries = queries[1:]
+	}
+
+	return chosenSongs(found, candidates, track, result, opts, allCopies), nil
+}
+
+// candidates converts songs to LovedTracks for matching
+func (s *Subsonic) candidates(client *subsonic.Client, songs []*subsonic.Child) ([]model.LovedTrack, error) {
+	artistMBIDs, err := s.artistMBIDsFor(client, songs)
 	if err != nil {
 		return nil, err
 	}
@@ -292,18 +897,203 @@ func (s *Subsonic) findSongs(tracks []model.LovedTrack) ([]*subsonic.Child, erro
 		return nil, err
 	}
 
-	candidates := s.childToLovedTrack(allSongs, artistMBIDs, albumMBIDs)
-	var songs []*subsonic.Child
-	for _, track := range tracks {
-		matchIndex := matcher.Find(candidates, track)
-		if matchIndex == -1 {
-			slog.Warn("Song not found", "artist", track.Artist, "track", track.Track, "source", "subsonic")
-			continue
+	return s.childToLovedTrack(songs, artistMBIDs, albumMBIDs), nil
+}
+
+// search performs a search3 query for songs in the given music folder, or the
+// whole library if it's empty
+func (s *Subsonic) search(client *subsonic.Client, query string, count, offset int, folder string) ([]*subsonic.Child, error) {
+	resp, err := s.get(client, "search3", inFolder(map[string]string{
+		"query":       query,
+		"songCount":   strconv.Itoa(count),
+		"songOffset":  strconv.Itoa(offset),
+		"artistCount": "0",
+		"albumCount":  "0",
+	}, folder))
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.SearchResult3 == nil {
+		return nil, nil
+	}
+	return resp.SearchResult3.Song, nil
+}
+
+// searchesMBIDs determines whether searching the server for a recording MBID
+// finds the songs with it. Few servers support this, so the first time it's
+// needed, a song with an MBID is searched for to see if it turns up.
+func (s *Subsonic) searchesMBIDs(client *subsonic.Client) bool {
+	s.mbidSearchOnce.Do(func() {
+		song, err := s.songWithMBID(client)
+		if err != nil || song == nil {
+			slog.Debug("Couldn't find a song to check searching by MBID with, not searching by MBID", "error", err, "source", "subsonic")
+			return
+		}
+
+		for _, folder := range s.selectedFolders() {
+			found, err := s.search(client, song.MusicBrainzID, lookupSongCount, 0, folder)
+			if err != nil {
+				slog.Debug("Failed to search by MBID, not searching by MBID", "error", err, "source", "subsonic")
+				return
+			}
+
+			if slices.ContainsFunc(found, func(c *subsonic.Child) bool { return c.ID == song.ID }) {
+				s.mbidSearch = true
+				break
+			}
+		}
+		slog.Debug("Checked whether the server can search by MBID", "supported", s.mbidSearch, "source", "subsonic")
+	})
+	return s.mbidSearch
+}
+
+// songWithMBID finds a song with a recording MBID among the newest albums in
+// the library, or returns nil if there isn't one
+func (s *Subsonic) songWithMBID(client *subsonic.Client) (*subsonic.Child, error) {
+	for _, folder := range s.selectedFolders() {
+		albums, err := s.getAlbumList2(client, "newest", mbidProbeAlbums, 0, folder)
+		if err != nil {
+			return nil, err
 		}
 
-		songs = append(songs, allSongs[matchIndex])
+		for _, album := range albums {
+			resp, err := s.get(client, "getAlbum", map[string]string{"id": album.ID})
+			if err != nil {
+				return nil, err
+			}
+
+			if resp.Album == nil {
+				continue
+			}
+
+			for _, song := range resp.Album.Song {
+				if song.MusicBrainzID != "" {
+					return song, nil
+				}
+			}
+		}
 	}
-	return songs, nil
+	return nil, nil
+}
+
+// searchQueries returns the queries to try when searching for a track, most
+// specific first. Servers differ in what they search (some only look at
+// titles), so broader queries follow narrower ones.
+func searchQueries(track model.LovedTrack, byMBID bool) []string {
+	var queries []string
+	if byMBID && track.TrackMBID != "" {
+		queries = append(queries, track.TrackMBID)
+	}
+
+	title := searchTitle(track.Track)
+	if title == "" {
+		return queries
+	}
+
+	if artist := track.PrimaryArtist().Name; artist != "" {
+		queries = append(queries, artist+" "+title)
+	}
+	return append(queries, title)
+}
+
+// searchTitle strips any version or featured artists from a title, as most
+// servers only return songs containing every word searched for
+func searchTitle(title string) string {
+	if i := strings.IndexAny(title, "(["); i > 0 {
+		title = title[:i]
+	}
+	if i := strings.Index(title, " - "); i > 0 {
+		title = title[:i]
+	}
+	return strings.TrimSpace(title)
+}
+
+// chosenSongs returns the song picked by a search, along with any copies of it
+// if allCopies is set. If no song was picked, the reason is logged.
+func chosenSongs(songs []*subsonic.Child, candidates []model.LovedTrack, track model.LovedTrack, result matcher.Result, opts []matcher.Option, allCopies bool) []*subsonic.Child {
+	if len(result.Ambiguous) > 0 {
+		var ids []string
+		for _, index := range result.Ambiguous {
+			ids = append(ids, songs[index].ID)
+		}
+		slog.Warn("Song is ambiguous, skipping", "artist", track.Artist, "track", track.Track, "candidates", ids, "source", "subsonic")
+		return nil
+	}
+
+	if result.Index == -1 {
+		slog.Warn("Song not found", "artist", track.Artist, "track", track.Track, "source", "subsonic")
+		return nil
+	}
+
+	chosen := []*subsonic.Child{songs[result.Index]}
+	if allCopies {
+		for _, index := range matcher.Copies(candidates, result.Index, opts...) {
+			chosen = append(chosen, songs[index])
+		}
+	}
+	return chosen
+}
+
+// resolveFolders finds the IDs of the music folders given in MusicFolders
+func (s *Subsonic) resolveFolders(client *subsonic.Client) error {
+	if len(s.MusicFolders) == 0 {
+		return nil
+	}
+
+	folders, err := client.GetMusicFolders()
+	if err != nil {
+		return err
+	}
+
+	s.folderIDs = nil
+	for _, name := range s.MusicFolders {
+		index := slices.IndexFunc(folders, func(folder *subsonic.MusicFolder) bool {
+			return strings.EqualFold(folder.Name, name) || folder.ID == name
+		})
+		if index == -1 {
+			var available []string
+			for _, folder := range folders {
+				available = append(available, fmt.Sprintf("%s (%s)", folder.Name, folder.ID))
+			}
+			return fmt.Errorf("unknown music folder %q, available folders are: %s", name, strings.Join(available, ", "))
+		}
+
+		s.folderIDs = append(s.folderIDs, folders[index].ID)
+	}
+
+	slog.Debug("Using selected music folders", "folders", s.folderIDs, "source", "subsonic")
+	return nil
+}
+
+// selectedFolders returns the IDs of the music folders to make requests for,
+// or a single empty ID if the whole library is used
+func (s *Subsonic) selectedFolders() []string {
+	if len(s.folderIDs) == 0 {
+		return []string{""}
+	}
+	return s.folderIDs
+}
+
+// inFolder adds the parameter limiting a request to the given music folder,
+// if there is one
+func inFolder(params map[string]string, folder string) map[string]string {
+	if folder != "" {
+		params["musicFolderId"] = folder
+	}
+	return params
+}
+
+// pairingNamespace identifies this server, user and selection of music
+// folders in remembered pairings, so that songs outside the folders aren't
+// reused. The user is the one the server authenticated, so getClient must
+// have been called first.
+func (s *Subsonic) pairingNamespace() string {
+	namespace := "subsonic:" + s.BaseURL + "|" + s.user
+	if len(s.MusicFolders) > 0 {
+		namespace += "|" + strings.Join(s.MusicFolders, ",")
+	}
+	return namespace
 }
 
 var _ model.Source = &Subsonic{}
@@ -0,0 +1,477 @@
+package sources
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"log/slog"
+	"maps"
+	"slices"
+	"strconv"
+	"time"
+
+	"github.com/csmith/musiclover/state"
+	"github.com/supersonic-app/go-subsonic/subsonic"
+)
+
+const (
+	// libraryCheckInterval is how long to wait between checking the server for
+	// changes to the library, so that a single update doesn't check repeatedly
+	libraryCheckInterval = time.Minute
+
+	// newAlbumsBatchSize is how many albums are requested at a time when
+	// looking for ones added since the index was built
+	newAlbumsBatchSize = 50
+
+	// albumListBatchSize is how many albums are requested at a time when
+	// listing every album
+	albumListBatchSize = 500
+)
+
+// subsonicLibrary is an index of the songs, artists and albums in a Subsonic
+// library. Each part is only retrieved when it's first needed, and is nil
+// until then.
+type subsonicLibrary struct {
+	Songs       []*subsonic.Child `json:"songs"`
+	ArtistMBIDs map[string]string `json:"artist_mbids"`
+	AlbumMBIDs  map[string]string `json:"album_mbids"`
+	// AlbumVersions holds when each album was last changed or added, as reported by the server
+	AlbumVersions map[string]string `json:"album_versions,omitempty"`
+	// Extras holds the OpenSubsonic fields of songs that the client library doesn't support
+	Extras map[string]subsonicSongExtras `json:"extras,omitempty"`
+	// LastModified is when the server last said its library changed, in milliseconds since the epoch
+	LastModified int64 `json:"last_modified,omitempty"`
+	// Built is when the index was started from scratch
+	Built time.Time `json:"built"`
+}
+
+// libraryIndex returns the index of the library, reading it from StateDir the
+// first time and checking the server for changes if it hasn't done so
+// recently. s.mu must be held.
+func (s *Subsonic) libraryIndex(client *subsonic.Client) (*subsonicLibrary, error) {
+	if s.library == nil {
+		library := &subsonicLibrary{}
+		if err := state.Load(s.StateDir, s.libraryFile(), library); err != nil {
+			return nil, err
+		}
+		s.library = library
+		s.restoreExtras(library.Extras)
+	}
+
+	if s.library.Built.IsZero() || (s.RebuildInterval > 0 && time.Since(s.library.Built) > s.RebuildInterval) {
+		if !s.library.Built.IsZero() {
+			slog.Info("Rebuilding library index", "built", s.library.Built, "source", "subsonic")
+		}
+		s.library = &subsonicLibrary{Built: time.Now()}
+		s.libraryDirty = true
+	}
+
+	if time.Since(s.checked) > libraryCheckInterval {
+		if err := s.checkForChanges(client); err != nil {
+			return nil, err
+		}
+		s.checked = time.Now()
+	}
+
+	return s.library, s.saveLibrary()
+}
+
+// checkForChanges asks the server whether the library has changed since the
+// index was built, and if so brings the albums in the index up to date.
+// Servers that don't say when the library changed only have new albums
+// added, so songs that have been removed stay in the index until it's next
+// rebuilt.
+func (s *Subsonic) checkForChanges(client *subsonic.Client) error {
+	library := s.library
+
+	params := map[string]string{}
+	if library.LastModified > 0 {
+		params["ifModifiedSince"] = strconv.FormatInt(library.LastModified, 10)
+	}
+
+	resp, err := s.get(client, "getIndexes", params)
+	if err != nil {
+		return err
+	}
+
+	// Servers that don't say when the library last changed are checked for new albums every time
+	if resp.Indexes != nil && resp.Indexes.LastModified > 0 {
+		if resp.Indexes.LastModified <= library.LastModified {
+			return nil
+		}
+
+		first := library.LastModified == 0
+		library.LastModified = resp.Indexes.LastModified
+		s.libraryDirty = true
+		if first {
+			return nil
+		}
+
+		slog.Debug("Library has changed, updating index", "source", "subsonic")
+
+		// Artists are cheap to retrieve again, and may have gained MBIDs
+		library.ArtistMBIDs = nil
+		return s.refreshAlbums(client)
+	}
+
+	return s.addNewAlbums(client)
+}
+
+// refreshAlbums brings the index up to date with every album in the library.
+// Songs from albums that have gone are dropped, and the songs of albums that
+// are new, have a different number of songs or MBID, or that the server says
+// have changed are retrieved again. Edits that don't change any of those,
+// such as retagging a title on a server that doesn't date changes to albums,
+// aren't seen until the index is rebuilt.
+func (s *Subsonic) refreshAlbums(client *subsonic.Client) error {
+	library := s.library
+	if library.AlbumMBIDs == nil {
+		// Nothing has been indexed yet, so there's nothing to update
+		return nil
+	}
+
+	albums, err := s.listAlbums(client)
+	if err != nil {
+		return err
+	}
+
+	indexed := make(map[string]int)
+	for _, song := range library.Songs {
+		indexed[song.AlbumID]++
+	}
+
+	albumMBIDs := make(map[string]string, len(albums))
+	versions := make(map[string]string, len(albums))
+	stale := make(map[string]bool)
+	for _, album := range albums {
+		albumMBIDs[album.ID] = album.MusicBrainzID
+		versions[album.ID] = album.version()
+
+		mbid, ok := library.AlbumMBIDs[album.ID]
+		// Indexes saved before versions were recorded don't have one to compare against
+		previous := library.AlbumVersions[album.ID]
+		changed := previous != "" && previous != album.version()
+		if !ok || mbid != album.MusicBrainzID || indexed[album.ID] != album.SongCount || changed {
+			stale[album.ID] = true
+		}
+	}
+
+	if library.Songs != nil {
+		var songs []*subsonic.Child
+		for _, song := range library.Songs {
+			// Songs without an album can't be checked, so are kept
+			_, ok := albumMBIDs[song.AlbumID]
+			if song.AlbumID == "" || (ok && !stale[song.AlbumID]) {
+				songs = append(songs, song)
+			}
+		}
+
+		for _, id := range slices.Sorted(maps.Keys(stale)) {
+			resp, err := s.get(client, "getAlbum", map[string]string{"id": id})
+			if err != nil {
+				return err
+			}
+
+			if resp.Album != nil {
+				songs = append(songs, resp.Album.Song...)
+			}
+		}
+
+		slog.Debug("Updated library index", "songs", len(songs), "previous_songs", len(library.Songs), "updated_albums", len(stale), "source", "subsonic")
+		library.Songs = songs
+	}
+
+	library.AlbumMBIDs = albumMBIDs
+	library.AlbumVersions = versions
+	s.libraryDirty = true
+	return nil
+}
+
+// listAlbums retrieves every album in the selected music folders
+func (s *Subsonic) listAlbums(client *subsonic.Client) ([]subsonicAlbum, error) {
+	var albums []subsonicAlbum
+	for _, folder := range s.selectedFolders() {
+		for offset := 0; ; offset += albumListBatchSize {
+			batch, err := s.getAlbumList2(client, "alphabeticalByName", albumListBatchSize, offset, folder)
+			if err != nil {
+				return nil, err
+			}
+
+			albums = append(albums, batch...)
+			if len(batch) < albumListBatchSize {
+				break
+			}
+		}
+	}
+	return albums, nil
+}
+
+// addNewAlbums adds albums that aren't in the index yet, going through the
+// newest albums until a whole batch of them are already known
+func (s *Subsonic) addNewAlbums(client *subsonic.Client) error {
+	library := s.library
+	if library.AlbumMBIDs == nil {
+		// Nothing has been indexed yet, so there's nothing to add to
+		return nil
+	}
+
+	albumMBIDs := maps.Clone(library.AlbumMBIDs)
+	versions := maps.Clone(library.AlbumVersions)
+	if versions == nil {
+		versions = make(map[string]string)
+	}
+	songs := library.Songs
+	added := 0
+
+	for _, folder := range s.selectedFolders() {
+		for offset := 0; ; offset += newAlbumsBatchSize {
+			albums, err := s.getAlbumList2(client, "newest", newAlbumsBatchSize, offset, folder)
+			if err != nil {
+				return err
+			}
+
+			found := false
+			for _, album := range albums {
+				if _, ok := albumMBIDs[album.ID]; ok {
+					continue
+				}
+
+				found = true
+				added++
+				albumMBIDs[album.ID] = album.MusicBrainzID
+				versions[album.ID] = album.version()
+
+				if songs == nil {
+					continue
+				}
+
+				resp, err := s.get(client, "getAlbum", map[string]string{"id": album.ID})
+				if err != nil {
+					return err
+				}
+
+				if resp.Album != nil {
+					songs = append(songs, resp.Album.Song...)
+				}
+			}
+
+			if !found || len(albums) < newAlbumsBatchSize {
+				break
+			}
+		}
+	}
+
+	if added == 0 {
+		return nil
+	}
+
+	slog.Debug("Added new albums to library index", "count", added, "source", "subsonic")
+	library.AlbumMBIDs = albumMBIDs
+	library.AlbumVersions = versions
+	library.Songs = songs
+	s.libraryDirty = true
+	return nil
+}
+
+// saveLibrary writes the index of the library to StateDir, if it has changed.
+// s.mu must be held.
+func (s *Subsonic) saveLibrary() error {
+	if !s.libraryDirty {
+		return nil
+	}
+
+	s.extrasMu.Lock()
+	s.library.Extras = maps.Clone(s.songExtras)
+	s.extrasMu.Unlock()
+
+	if err := state.Save(s.StateDir, s.libraryFile(), s.library); err != nil {
+		return err
+	}
+	s.libraryDirty = false
+	return nil
+}
+
+// restoreExtras adds song extras read from a saved index to those recorded
+// from responses
+func (s *Subsonic) restoreExtras(extras map[string]subsonicSongExtras) {
+	s.extrasMu.Lock()
+	defer s.extrasMu.Unlock()
+
+	if s.songExtras == nil {
+		s.songExtras = make(map[string]subsonicSongExtras)
+	}
+
+	for id, extra := range extras {
+		if _, ok := s.songExtras[id]; !ok {
+			extra.ID = id
+			s.songExtras[id] = extra
+		}
+	}
+}
+
+// libraryFile is the name of the file the index of the library is saved in.
+// Each server, user and selection of music folders has their own.
+func (s *Subsonic) libraryFile() string {
+	hash := sha256.Sum256([]byte(s.pairingNamespace()))
+	return "subsonic-library-" + hex.EncodeToString(hash[:8]) + ".json"
+}
+
+// libraryCount returns the number of songs the server says are in the
+// library, or 0 if it doesn't say. The scan status covers every music folder,
+// so if only some are being used, or the server doesn't report its scan
+// status, the song counts of the albums in them are added up instead.
+func (s *Subsonic) libraryCount(client *subsonic.Client) int {
+	if len(s.folderIDs) == 0 {
+		status, err := client.GetScanStatus()
+		if err == nil && status != nil && status.Count > 0 {
+			return int(status.Count)
+		}
+	}
+
+	albums, err := s.listAlbums(client)
+	if err != nil {
+		slog.Debug("Failed to count songs in albums", "error", err, "source", "subsonic")
+		return 0
+	}
+
+	count := 0
+	for _, album := range albums {
+		count += album.SongCount
+	}
+	return count
+}
+
+// incomplete determines whether an empty search looks to have missed songs
+// in the library. Some servers return nothing for an empty query, and others
+// only return some songs.
+func incomplete(found, expected int) bool {
+	if expected == 0 {
+		return found == 0
+	}
+	return found < expected
+}
+
+// walkLibrary retrieves every song by browsing the library, for servers that
+// don't return everything from an empty search. The library is browsed by
+// artist and album if possible, or by folder for servers that don't support
+// browsing by tags.
+func (s *Subsonic) walkLibrary(client *subsonic.Client) ([]*subsonic.Child, error) {
+	slog.Debug("Browsing library by artist", "source", "subsonic")
+
+	songs, err := s.walkArtists(client)
+	if err == nil {
+		return songs, nil
+	}
+
+	slog.Debug("Failed to browse library by artist, browsing by folder instead", "error", err, "source", "subsonic")
+	return s.walkFolders(client)
+}
+
+// walkArtists retrieves every song by going through each artist's albums
+func (s *Subsonic) walkArtists(client *subsonic.Client) ([]*subsonic.Child, error) {
+	var indexes []*subsonic.IndexID3
+	for _, folder := range s.selectedFolders() {
+		resp, err := s.get(client, "getArtists", inFolder(map[string]string{}, folder))
+		if err != nil {
+			return nil, err
+		}
+
+		if resp.Artists == nil {
+			return nil, fmt.Errorf("server didn't return any artists")
+		}
+		indexes = append(indexes, resp.Artists.Index...)
+	}
+
+	var songs []*subsonic.Child
+	seen := make(map[string]bool)
+	for _, index := range indexes {
+		for _, artist := range index.Artist {
+			resp, err := s.get(client, "getArtist", map[string]string{"id": artist.ID})
+			if err != nil {
+				return nil, err
+			}
+
+			if resp.Artist == nil {
+				continue
+			}
+
+			// Albums by several artists may be listed under each of them
+			for _, album := range resp.Artist.Album {
+				if seen[album.ID] {
+					continue
+				}
+				seen[album.ID] = true
+
+				resp, err := s.get(client, "getAlbum", map[string]string{"id": album.ID})
+				if err != nil {
+					return nil, err
+				}
+
+				if resp.Album != nil {
+					songs = append(songs, resp.Album.Song...)
+				}
+			}
+		}
+	}
+
+	return songs, nil
+}
+
+// walkFolders retrieves every song by going through each directory in the
+// library's folder structure
+func (s *Subsonic) walkFolders(client *subsonic.Client) ([]*subsonic.Child, error) {
+	var songs []*subsonic.Child
+	var queue []string
+	seen := make(map[string]bool)
+
+	visit := func(children []*subsonic.Child) {
+		for _, child := range children {
+			switch {
+			case child.IsDir:
+				if !seen[child.ID] {
+					seen[child.ID] = true
+					queue = append(queue, child.ID)
+				}
+			case !child.IsVideo:
+				songs = append(songs, child)
+			}
+		}
+	}
+
+	for _, folder := range s.selectedFolders() {
+		resp, err := s.get(client, "getIndexes", inFolder(map[string]string{}, folder))
+		if err != nil {
+			return nil, err
+		}
+
+		if resp.Indexes == nil {
+			return nil, fmt.Errorf("server didn't return any folders")
+		}
+
+		for _, index := range resp.Indexes.Index {
+			for _, artist := range index.Artist {
+				if !seen[artist.ID] {
+					seen[artist.ID] = true
+					queue = append(queue, artist.ID)
+				}
+			}
+		}
+		visit(resp.Indexes.Child)
+	}
+
+	for len(queue) > 0 {
+		id := queue[0]
+		queue = queue[1:]
+
+		resp, err := s.get(client, "getMusicDirectory", map[string]string{"id": id})
+		if err != nil {
+			return nil, err
+		}
+
+		if resp.Directory != nil {
+			visit(resp.Directory.Child)
+		}
+	}
+
+	return songs, nil
+}
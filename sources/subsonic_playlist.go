@@ -0,0 +1,248 @@
+package sources
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"log/slog"
+	"maps"
+	"slices"
+	"time"
+
+	"github.com/csmith/musiclover/model"
+	"github.com/csmith/musiclover/state"
+	"github.com/supersonic-app/go-subsonic/subsonic"
+)
+
+// getPlaylist retrieves the playlist named in Playlist, with its entries. If
+// it doesn't exist yet, it's created if create is set, otherwise nil is
+// returned.
+func (s *Subsonic) getPlaylist(client *subsonic.Client, create bool) (*subsonic.Playlist, error) {
+	id, err := s.findPlaylist(client)
+	if err != nil {
+		return nil, err
+	}
+
+	if id == "" && !create {
+		return nil, nil
+	}
+
+	if id == "" {
+		slog.Info("Creating playlist", "name", s.Playlist, "source", "subsonic")
+		if _, err := client.CreatePlaylist(map[string]string{"name": s.Playlist}); err != nil {
+			return nil, err
+		}
+
+		// Older servers don't return the new playlist, so look for it again
+		id, err = s.findPlaylist(client)
+		if err != nil {
+			return nil, err
+		}
+
+		if id == "" {
+			return nil, fmt.Errorf("playlist %q not found after creating it", s.Playlist)
+		}
+	}
+
+	resp, err := s.get(client, "getPlaylist", map[string]string{"id": id})
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.Playlist == nil {
+		return nil, fmt.Errorf("server didn't return playlist %q", s.Playlist)
+	}
+
+	slog.Debug("Retrieved playlist", "name", s.Playlist, "count", len(resp.Playlist.Entry), "source", "subsonic")
+	resp.Playlist.ID = id
+	return resp.Playlist, nil
+}
+
+// findPlaylist returns the ID of the user's playlist named in Playlist, or
+// an empty string if there isn't one
+func (s *Subsonic) findPlaylist(client *subsonic.Client) (string, error) {
+	resp, err := s.get(client, "getPlaylists", nil)
+	if err != nil {
+		return "", err
+	}
+
+	if resp.Playlists == nil {
+		return "", nil
+	}
+
+	for _, playlist := range resp.Playlists.Playlist {
+		// Other users' public playlists are listed too, but can't be changed.
+		// Servers that don't report owners only list the user's own.
+		if playlist.Name == s.Playlist && (playlist.Owner == "" || playlist.Owner == s.user) {
+			return playlist.ID, nil
+		}
+	}
+	return "", nil
+}
+
+// lovePlaylist adds the songs for tracks to the playlist, remembering when
+// each track was loved
+func (s *Subsonic) lovePlaylist(tracks []model.LovedTrack) error {
+	found, err := s.findSongsEach(tracks, false)
+	if err != nil {
+		return err
+	}
+
+	var songs []*subsonic.Child
+	lovedAt := make(map[string]time.Time)
+	for i, matches := range found {
+		for _, song := range matches {
+			songs = append(songs, song)
+			lovedAt[song.ID] = tracks[i].LovedAt
+		}
+	}
+
+	if len(songs) == 0 {
+		return nil
+	}
+
+	client, err := s.getClient()
+	if err != nil {
+		return err
+	}
+
+	return s.addToPlaylist(client, songs, lovedAt)
+}
+
+// addToPlaylist adds songs that aren't already in the playlist, and rewrites
+// it so that every entry is in the order it was loved. Entries whose loved
+// date isn't known keep their place after the entry before them.
+func (s *Subsonic) addToPlaylist(client *subsonic.Client, songs []*subsonic.Child, lovedAt map[string]time.Time) error {
+	playlist, err := s.getPlaylist(client, true)
+	if err != nil {
+		return err
+	}
+
+	dates, err := s.playlistDates()
+	if err != nil {
+		return err
+	}
+
+	type entry struct {
+		id      string
+		lovedAt time.Time
+	}
+
+	var entries []entry
+	present := make(map[string]bool)
+	for _, song := range playlist.Entry {
+		present[song.ID] = true
+		entries = append(entries, entry{id: song.ID, lovedAt: dates[song.ID]})
+	}
+
+	added := 0
+	for _, song := range songs {
+		if present[song.ID] {
+			continue
+		}
+		present[song.ID] = true
+		added++
+		entries = append(entries, entry{id: song.ID, lovedAt: lovedAt[song.ID]})
+		if !lovedAt[song.ID].IsZero() {
+			dates[song.ID] = lovedAt[song.ID]
+		}
+	}
+
+	if added == 0 {
+		return nil
+	}
+
+	var previous time.Time
+	for i := range entries {
+		if entries[i].lovedAt.IsZero() {
+			entries[i].lovedAt = previous
+		}
+		previous = entries[i].lovedAt
+	}
+
+	slices.SortStableFunc(entries, func(a, b entry) int {
+		return a.lovedAt.Compare(b.lovedAt)
+	})
+
+	ids := make([]string, len(entries))
+	for i, e := range entries {
+		ids[i] = e.id
+	}
+
+	slog.Debug("Rewriting playlist", "name", s.Playlist, "added", added, "count", len(ids), "source", "subsonic")
+	if err := client.CreatePlaylistWithTracks(ids, map[string]string{"playlistId": playlist.ID}); err != nil {
+		return err
+	}
+	return s.savePlaylistDates(dates)
+}
+
+// removeFromPlaylist removes every entry for the songs from the playlist
+func (s *Subsonic) removeFromPlaylist(client *subsonic.Client, songs []*subsonic.Child) error {
+	playlist, err := s.getPlaylist(client, false)
+	if err != nil || playlist == nil {
+		return err
+	}
+
+	remove := make(map[string]bool)
+	for _, song := range songs {
+		remove[song.ID] = true
+	}
+
+	var indexes []int
+	for i, entry := range playlist.Entry {
+		if remove[entry.ID] {
+			indexes = append(indexes, i)
+		}
+	}
+
+	if len(indexes) == 0 {
+		return nil
+	}
+
+	if err := client.UpdatePlaylistTracks(playlist.ID, nil, indexes); err != nil {
+		return err
+	}
+
+	dates, err := s.playlistDates()
+	if err != nil {
+		return err
+	}
+	maps.DeleteFunc(dates, func(id string, _ time.Time) bool {
+		return remove[id]
+	})
+	return s.savePlaylistDates(dates)
+}
+
+// playlistDates returns when each song in the playlist was loved, for those
+// added by musiclover, reading them from StateDir the first time. The map
+// can be changed and passed to savePlaylistDates.
+func (s *Subsonic) playlistDates() (map[string]time.Time, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.playlistLovedAt == nil {
+		dates := make(map[string]time.Time)
+		if err := state.Load(s.StateDir, s.playlistFile(), &dates); err != nil {
+			return nil, err
+		}
+		s.playlistLovedAt = dates
+	}
+	return maps.Clone(s.playlistLovedAt), nil
+}
+
+// savePlaylistDates replaces the dates that songs in the playlist were loved,
+// and writes them to StateDir
+func (s *Subsonic) savePlaylistDates(dates map[string]time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.playlistLovedAt = dates
+	return state.Save(s.StateDir, s.playlistFile(), dates)
+}
+
+// playlistFile is the name of the file the dates songs in the playlist were
+// loved are saved in. Each server, user and playlist has their own.
+func (s *Subsonic) playlistFile() string {
+	hash := sha256.Sum256([]byte("subsonic:" + s.BaseURL + "|" + s.user + "|" + s.Playlist))
+	return "subsonic-playlist-" + hex.EncodeToString(hash[:8]) + ".json"
+}
@@ -0,0 +1,128 @@
+package sources
+
+import (
+	"log/slog"
+	"maps"
+	"slices"
+	"time"
+
+	"github.com/csmith/musiclover/model"
+	"github.com/supersonic-app/go-subsonic/subsonic"
+)
+
+// RatedTracks retrieves every song with a rating from the Subsonic server.
+// There's no way to ask for just the rated songs, so the whole library is
+// retrieved, and the library index is updated with it while we're at it.
+func (s *Subsonic) RatedTracks() ([]model.LovedTrack, error) {
+	client, err := s.getClient()
+	if err != nil {
+		return nil, err
+	}
+
+	songs, err := s.refreshSongs(client)
+	if err != nil {
+		return nil, err
+	}
+
+	var rated []*subsonic.Child
+	for _, song := range songs {
+		if song.UserRating > 0 {
+			rated = append(rated, song)
+		}
+	}
+
+	slog.Debug("Retrieved rated tracks", "count", len(rated), "source", "subsonic")
+	return s.candidates(client, rated)
+}
+
+// Rate sets the rating of songs on the Subsonic server. Every copy of a track
+// has its rating removed, but only the preferred copy is rated unless
+// StarAllCopies is set.
+func (s *Subsonic) Rate(tracks []model.LovedTrack) error {
+	byRating := make(map[int][]model.LovedTrack)
+	for _, track := range tracks {
+		byRating[track.Rating] = append(byRating[track.Rating], track)
+	}
+
+	for _, rating := range slices.Sorted(maps.Keys(byRating)) {
+		songs, err := s.findSongs(byRating[rating], rating == 0 || s.StarAllCopies)
+		if err != nil {
+			return err
+		}
+
+		if len(songs) == 0 {
+			continue
+		}
+
+		client, err := s.getClient()
+		if err != nil {
+			return err
+		}
+
+		// Ratings can only be set one song at a time
+		for _, song := range songs {
+			if err := client.SetRating(song.ID, rating); err != nil {
+				return err
+			}
+		}
+
+		if err := s.updateIndexedRatings(songs, rating); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// refreshSongs retrieves every song from the server and replaces the songs in
+// the library index with them, unless that was done within the last
+// libraryCheckInterval
+func (s *Subsonic) refreshSongs(client *subsonic.Client) ([]*subsonic.Child, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	library, err := s.libraryIndex(client)
+	if err != nil {
+		return nil, err
+	}
+
+	if library.Songs != nil && time.Since(s.songsRefreshed) < libraryCheckInterval {
+		return library.Songs, nil
+	}
+
+	songs, err := s.fetchAllSongs(client)
+	if err != nil {
+		return nil, err
+	}
+
+	library.Songs = songs
+	s.songsRefreshed = time.Now()
+	s.libraryDirty = true
+	return songs, s.saveLibrary()
+}
+
+// updateIndexedRatings sets the rating of the songs in the library index,
+// so that the ratings that have just been given are seen on later runs
+func (s *Subsonic) updateIndexedRatings(songs []*subsonic.Child, rating int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.library == nil {
+		return nil
+	}
+
+	ids := make(map[string]bool)
+	for _, song := range songs {
+		ids[song.ID] = true
+	}
+
+	for _, song := range s.library.Songs {
+		if ids[song.ID] && song.UserRating != rating {
+			song.UserRating = rating
+			s.libraryDirty = true
+		}
+	}
+	return s.saveLibrary()
+}
+
+var _ model.RatingSource = &Subsonic{}
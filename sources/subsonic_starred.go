@@ -0,0 +1,302 @@
+package sources
+
+import (
+	"log/slog"
+	"maps"
+	"slices"
+	"strconv"
+
+	"github.com/csmith/musiclover/matcher"
+	"github.com/csmith/musiclover/model"
+	"github.com/supersonic-app/go-subsonic/subsonic"
+)
+
+// lookupEntityCount is how many albums or artists are requested when
+// searching for one to star
+const lookupEntityCount = 20
+
+// LovedAlbums retrieves starred albums from the Subsonic server. Playlists
+// only hold songs, so there are never any in playlist mode.
+func (s *Subsonic) LovedAlbums() ([]model.LovedAlbum, error) {
+	if s.Playlist != "" {
+		return nil, nil
+	}
+
+	client, err := s.getClient()
+	if err != nil {
+		return nil, err
+	}
+
+	starred, err := s.getStarred(client)
+	if err != nil {
+		return nil, err
+	}
+
+	return s.albumCandidates(client, starred.Album)
+}
+
+// LovedArtists retrieves starred artists from the Subsonic server. Playlists
+// only hold songs, so there are never any in playlist mode.
+func (s *Subsonic) LovedArtists() ([]model.LovedArtist, error) {
+	if s.Playlist != "" {
+		return nil, nil
+	}
+
+	client, err := s.getClient()
+	if err != nil {
+		return nil, err
+	}
+
+	starred, err := s.getStarred(client)
+	if err != nil {
+		return nil, err
+	}
+
+	return artistCandidates(starred.Artist), nil
+}
+
+// LoveAlbums stars albums on the Subsonic server
+func (s *Subsonic) LoveAlbums(albums []model.LovedAlbum) error {
+	if s.skipEntities("albums", len(albums)) {
+		return nil
+	}
+
+	client, err := s.getClient()
+	if err != nil {
+		return err
+	}
+
+	var ids []string
+	for _, album := range albums {
+		id, err := s.findAlbum(client, album)
+		if err != nil {
+			return err
+		}
+		if id != "" {
+			ids = append(ids, id)
+		}
+	}
+
+	if len(ids) == 0 {
+		return nil
+	}
+
+	return client.Star(subsonic.StarParameters{AlbumIDs: ids})
+}
+
+// UnloveAlbums unstars albums on the Subsonic server. The albums are expected
+// to have come from LovedAlbums, so are identified by their IDs.
+func (s *Subsonic) UnloveAlbums(albums []model.LovedAlbum) error {
+	if s.skipEntities("albums", len(albums)) {
+		return nil
+	}
+
+	client, err := s.getClient()
+	if err != nil {
+		return err
+	}
+
+	var ids []string
+	for _, album := range albums {
+		ids = append(ids, album.ID)
+	}
+
+	return client.Unstar(subsonic.StarParameters{AlbumIDs: ids})
+}
+
+// LoveArtists stars artists on the Subsonic server
+func (s *Subsonic) LoveArtists(artists []model.LovedArtist) error {
+	if s.skipEntities("artists", len(artists)) {
+		return nil
+	}
+
+	client, err := s.getClient()
+	if err != nil {
+		return err
+	}
+
+	var ids []string
+	for _, artist := range artists {
+		id, err := s.findArtist(client, artist)
+		if err != nil {
+			return err
+		}
+		if id != "" {
+			ids = append(ids, id)
+		}
+	}
+
+	if len(ids) == 0 {
+		return nil
+	}
+
+	return client.Star(subsonic.StarParameters{ArtistIDs: ids})
+}
+
+// UnloveArtists unstars artists on the Subsonic server. The artists are
+// expected to have come from LovedArtists, so are identified by their IDs.
+func (s *Subsonic) UnloveArtists(artists []model.LovedArtist) error {
+	if s.skipEntities("artists", len(artists)) {
+		return nil
+	}
+
+	client, err := s.getClient()
+	if err != nil {
+		return err
+	}
+
+	var ids []string
+	for _, artist := range artists {
+		ids = append(ids, artist.ID)
+	}
+
+	return client.Unstar(subsonic.StarParameters{ArtistIDs: ids})
+}
+
+// skipEntities determines whether there's nothing to do with the given number
+// of albums or artists, warning if they can't be added to a playlist
+func (s *Subsonic) skipEntities(kind string, count int) bool {
+	if count == 0 {
+		return true
+	}
+
+	if s.Playlist != "" {
+		slog.Warn("Playlists can only hold songs, skipping", "kind", kind, "count", count, "playlist", s.Playlist, "source", "subsonic")
+		return true
+	}
+	return false
+}
+
+// findAlbum looks for the album in the library, returning its ID or an empty
+// string if it can't be found. Albums are looked up by release MBID in the
+// library index first, then searched for by name.
+func (s *Subsonic) findAlbum(client *subsonic.Client, album model.LovedAlbum) (string, error) {
+	albumMBIDs, err := s.getAlbumMBIDs(client)
+	if err != nil {
+		return "", err
+	}
+
+	if album.MBID != "" {
+		for _, id := range slices.Sorted(maps.Keys(albumMBIDs)) {
+			if albumMBIDs[id] == album.MBID {
+				return id, nil
+			}
+		}
+	}
+
+	var found []*subsonic.AlbumID3
+	for _, folder := range s.selectedFolders() {
+		result, err := s.searchEntities(client, album.Artist+" "+searchTitle(album.Title), lookupEntityCount, 0, folder)
+		if err != nil {
+			return "", err
+		}
+		found = append(found, result.Album...)
+	}
+
+	candidates, err := s.albumCandidates(client, found)
+	if err != nil {
+		return "", err
+	}
+
+	index := matcher.FindAlbum(candidates, album, s.MatchOptions...)
+	if index == -1 {
+		slog.Warn("Album not found or ambiguous", "artist", album.Artist, "album", album.Title, "source", "subsonic")
+		return "", nil
+	}
+	return candidates[index].ID, nil
+}
+
+// findArtist looks for the artist in the library, returning its ID or an
+// empty string if it can't be found
+func (s *Subsonic) findArtist(client *subsonic.Client, artist model.LovedArtist) (string, error) {
+	var found []*subsonic.ArtistID3
+	for _, folder := range s.selectedFolders() {
+		result, err := s.searchEntities(client, artist.Name, 0, lookupEntityCount, folder)
+		if err != nil {
+			return "", err
+		}
+		found = append(found, result.Artist...)
+	}
+
+	candidates := artistCandidates(found)
+	index := matcher.FindArtist(candidates, artist, s.MatchOptions...)
+	if index == -1 {
+		slog.Warn("Artist not found or ambiguous", "artist", artist.Name, "source", "subsonic")
+		return "", nil
+	}
+	return candidates[index].ID, nil
+}
+
+// searchEntities performs a search3 query for albums and artists in the given
+// music folder, or the whole library if it's empty
+func (s *Subsonic) searchEntities(client *subsonic.Client, query string, albumCount, artistCount int, folder string) (*subsonic.SearchResult3, error) {
+	resp, err := s.get(client, "search3", inFolder(map[string]string{
+		"query":       query,
+		"songCount":   "0",
+		"albumCount":  strconv.Itoa(albumCount),
+		"artistCount": strconv.Itoa(artistCount),
+	}, folder))
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.SearchResult3 == nil {
+		return &subsonic.SearchResult3{}, nil
+	}
+	return resp.SearchResult3, nil
+}
+
+// albumCandidates converts albums to LovedAlbums for matching, adding their
+// MBIDs from the library index
+func (s *Subsonic) albumCandidates(client *subsonic.Client, albums []*subsonic.AlbumID3) ([]model.LovedAlbum, error) {
+	if len(albums) == 0 {
+		return nil, nil
+	}
+
+	albumMBIDs, err := s.getAlbumMBIDs(client)
+	if err != nil {
+		return nil, err
+	}
+
+	artistMBIDs, err := s.getArtistMBIDs(client)
+	if err != nil {
+		return nil, err
+	}
+
+	var result []model.LovedAlbum
+	for _, album := range albums {
+		result = append(result, model.LovedAlbum{
+			ID:         album.ID,
+			Title:      album.Name,
+			Artist:     album.Artist,
+			MBID:       albumMBIDs[album.ID],
+			ArtistMBID: artistMBIDs[album.ArtistID],
+			LovedAt:    album.Starred,
+		})
+	}
+	return result, nil
+}
+
+// artistCandidates converts artists to LovedArtists for matching
+func artistCandidates(artists []*subsonic.ArtistID3) []model.LovedArtist {
+	var result []model.LovedArtist
+	for _, artist := range artists {
+		result = append(result, model.LovedArtist{
+			ID:      artist.ID,
+			Name:    artist.Name,
+			MBID:    artist.MusicBrainzId,
+			LovedAt: artist.Starred,
+		})
+	}
+	return result
+}
+
+// Syncs determines whether the kind of love can be synced. Playlists only
+// hold songs, so albums and artists can't be synced in playlist mode.
+func (s *Subsonic) Syncs(kind string) bool {
+	return kind == "tracks" || s.Playlist == ""
+}
+
+var _ model.KindSource = &Subsonic{}
+var _ model.AlbumSource = &Subsonic{}
+var _ model.ArtistSource = &Subsonic{}